@@ -0,0 +1,122 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// An ASCIIMode determines if Help restricts its output to ASCII.
+type ASCIIMode int
+
+const (
+	ASCIIAuto   = ASCIIMode(iota) // Use ASCII if the locale is not UTF-8
+	ASCIIAlways                   // Always use ASCII
+	ASCIINever                    // Never restrict output to ASCII
+)
+
+// asciiMode is the mode set by SetHelpASCII.
+var asciiMode ASCIIMode
+
+// SetHelpASCII sets the ASCII mode used by Help.  When Help is restricted to
+// ASCII, common typographic and box drawing characters are replaced with
+// their ASCII equivalents and all other non-ASCII characters are replaced
+// with a ?.
+//
+// In the default mode, ASCIIAuto, output is restricted to ASCII if the locale
+// named by the first non-empty environment variable of LC_ALL, LC_CTYPE, and
+// LANG does not specify UTF-8.  Output is not restricted if none of them are
+// set.
+func SetHelpASCII(mode ASCIIMode) {
+	asciiMode = mode
+}
+
+// useASCII reports whether Help should restrict its output to ASCII.
+func useASCII() bool {
+	switch asciiMode {
+	case ASCIIAlways:
+		return true
+	case ASCIINever:
+		return false
+	}
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			locale = strings.ToLower(locale)
+			return !strings.Contains(locale, "utf-8") && !strings.Contains(locale, "utf8")
+		}
+	}
+	return false
+}
+
+// asciiReplacer maps common non-ASCII runes to ASCII.
+var asciiReplacer = map[rune]string{
+	' ': " ",   // no-break space
+	'©': "(c)", // copyright
+	'·': "*",   // middle dot
+	'×': "x",   // multiplication
+	'–': "-",   // en dash
+	'—': "-",   // em dash
+	'‘': "'",   // left single quote
+	'’': "'",   // right single quote
+	'“': `"`,   // left double quote
+	'”': `"`,   // right double quote
+	'•': "*",   // bullet
+	'…': "...", // ellipsis
+	'←': "<-",  // left arrow
+	'→': "->",  // right arrow
+}
+
+// toASCII returns s with all non-ASCII runes replaced.
+func toASCII(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case asciiReplacer[r] != "":
+			b.WriteString(asciiReplacer[r])
+		case r >= 0x2500 && r <= 0x257f: // box drawing
+			b.WriteByte(boxASCII(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// boxASCII returns the ASCII equivalent of the box drawing rune r.
+func boxASCII(r rune) byte {
+	switch r {
+	case '─', '━', '═', '╌', '╍', '┄', '┅', '┈', '┉':
+		return '-'
+	case '│', '┃', '║', '╎', '╏', '┆', '┇', '┊', '┋':
+		return '|'
+	}
+	return '+'
+}
+
+// An asciiWriter writes to w, replacing all non-ASCII runes.
+type asciiWriter struct {
+	w io.Writer
+}
+
+func (a asciiWriter) Write(buf []byte) (int, error) {
+	if _, err := io.WriteString(a.w, toASCII(string(buf))); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
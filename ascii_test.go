@@ -0,0 +1,74 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHelpASCII(t *testing.T) {
+	defer SetHelpASCII(ASCIIAuto)
+	opts := &struct {
+		Name  string `flag:"--name=NAME the widget’s name — “quoted”…"`
+		Box   bool   `flag:"--box ┌─┐ │x│ └─┘ • ü"`
+		Plain bool   `flag:"--plain nothing special"`
+	}{}
+	want := `
+Usage: cmd [--box] [--name=NAME] [--plain]
+  --box          +-+ |x| +-+ * ?
+  --name=NAME    the widget's name - "quoted"...
+  --plain        nothing special
+`[1:]
+
+	SetHelpASCII(ASCIIAlways)
+	var out bytes.Buffer
+	Help(&out, "cmd", "", opts)
+	got := out.String()
+	for _, r := range got {
+		if r >= utf8.RuneSelf {
+			t.Errorf("found non-ASCII rune %q", r)
+		}
+	}
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	SetHelpASCII(ASCIINever)
+	out.Reset()
+	Help(&out, "cmd", "", opts)
+	if !bytes.ContainsRune(out.Bytes(), '—') {
+		t.Errorf("ASCIINever did not preserve UTF-8:\n%s", out.String())
+	}
+
+	SetHelpASCII(ASCIIAuto)
+	for _, tt := range []struct {
+		lcall, lang string
+		ascii       bool
+	}{
+		{"", "", false},
+		{"", "en_US.UTF-8", false},
+		{"", "C", true},
+		{"en_US.utf8", "C", false},
+		{"POSIX", "en_US.UTF-8", true},
+	} {
+		t.Setenv("LC_ALL", tt.lcall)
+		t.Setenv("LC_CTYPE", "")
+		t.Setenv("LANG", tt.lang)
+		if ascii := useASCII(); ascii != tt.ascii {
+			t.Errorf("LC_ALL=%q LANG=%q: got %v, want %v", tt.lcall, tt.lang, ascii, tt.ascii)
+		}
+	}
+}
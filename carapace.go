@@ -0,0 +1,95 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"encoding/json"
+)
+
+// A carapaceSpec is the subset of a carapace-spec command description
+// generated by CarapaceSpec.
+type carapaceSpec struct {
+	Name       string            `json:"name"`
+	Flags      map[string]string `json:"flags,omitempty"`
+	Completion *struct {
+		Flag map[string][]string `json:"flag,omitempty"`
+	} `json:"completion,omitempty"`
+}
+
+// CarapaceSpec returns a description of command and the options declared by
+// opts in the JSON form of a carapace-spec (https://carapace.sh) command.
+// Each flag is described by its name, or its short and long names, e.g.,
+// "-v, --verbose", and help.  Flags that take a parameter are suffixed with =
+// (or ? if the parameter is optional).  The values of flags with the
+// {choices} attribute complete to the choices.  Flags whose parameter is
+// named FILE or PATH complete to files and those whose parameter is named DIR
+// complete to directories.
+func CarapaceSpec(command string, opts any) ([]byte, error) {
+	descs, err := Describe(opts)
+	if err != nil {
+		return nil, err
+	}
+	spec := carapaceSpec{
+		Name:  command,
+		Flags: map[string]string{},
+	}
+	completions := map[string][]string{}
+	for _, d := range descs {
+		if d.Hidden {
+			continue
+		}
+		name := "--" + d.Name
+		switch {
+		case len(d.Name) == 1:
+			name = "-" + d.Name
+		case d.Short != "":
+			name = "-" + d.Short + ", " + name
+		}
+		switch {
+		case d.Bool:
+		case d.Optional:
+			name += "?"
+		default:
+			name += "="
+		}
+		spec.Flags[name] = d.Help
+		if c := completion(d); c != nil {
+			completions[d.Name] = c
+		}
+	}
+	if len(completions) > 0 {
+		spec.Completion = &struct {
+			Flag map[string][]string `json:"flag,omitempty"`
+		}{Flag: completions}
+	}
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// completion returns the carapace completion for the value of the flag
+// described by d, or nil.
+func completion(d Description) []string {
+	switch {
+	case len(d.Choices) > 0:
+		return d.Choices
+	case d.Bool:
+		return nil
+	}
+	switch valueHint(d) {
+	case "file":
+		return []string{"$files"}
+	case "directory":
+		return []string{"$directories"}
+	}
+	return nil
+}
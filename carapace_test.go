@@ -0,0 +1,67 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCarapaceSpec(t *testing.T) {
+	opts := &struct {
+		Input   string `flag:"--input=FILE the input file"`
+		Mode    string `flag:"--mode {choices=fast,slow} the mode"`
+		Color   string `flag:"--color=WHEN {optional-value=auto} colorize"`
+		Verbose bool   `flag:"-v be verbose"`
+		Count   int    `flag:"-c --count=N the count"`
+	}{}
+	data, err := CarapaceSpec("tool", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Name       string
+		Flags      map[string]string
+		Completion struct {
+			Flag map[string][]string
+		}
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("%v:\n%s", err, data)
+	}
+	if got.Name != "tool" {
+		t.Errorf("got name %q, want tool", got.Name)
+	}
+	wantFlags := map[string]string{
+		"--input=":     "the input file",
+		"--mode=":      "the mode",
+		"--color?":     "colorize",
+		"-v":           "be verbose",
+		"-c, --count=": "the count",
+	}
+	if !reflect.DeepEqual(got.Flags, wantFlags) {
+		t.Errorf("got flags %v, want %v", got.Flags, wantFlags)
+	}
+	wantCompletion := map[string][]string{
+		"input": {"$files"},
+		"mode":  {"fast", "slow"},
+	}
+	if !reflect.DeepEqual(got.Completion.Flag, wantCompletion) {
+		t.Errorf("got completion %v, want %v", got.Completion.Flag, wantCompletion)
+	}
+	if _, err := CarapaceSpec("tool", "bad"); err == nil {
+		t.Errorf("did not get an error for bad options")
+	}
+}
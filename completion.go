@@ -0,0 +1,122 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// A completionSpec is the document generated by CompletionSpec.
+type completionSpec struct {
+	Flags []completionFlag `json:"flags"`
+}
+
+// A completionFlag describes a single flag in a completionSpec.
+type completionFlag struct {
+	Name        string   `json:"name"`                 // name without dashes
+	Flag        string   `json:"flag"`                 // name with dashes
+	Short       bool     `json:"short,omitempty"`      // a single character name
+	ShortFlag   string   `json:"short_flag,omitempty"` // short name with a dash
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type"`
+	Value       string   `json:"value,omitempty"` // "required" or "optional"
+	Param       string   `json:"param,omitempty"`
+	Choices     []string `json:"choices,omitempty"`
+	Hint        string   `json:"hint,omitempty"` // "file" or "directory"
+}
+
+// CompletionSpec returns a JSON document describing the options declared by
+// opts for use by shell completion.  The document is not specific to any
+// shell and is intended to be transformed into the form a shell requires.
+// As an example:
+//
+//	{
+//	  "flags": [
+//	    {
+//	      "name": "config",
+//	      "flag": "--config",
+//	      "description": "the configuration file",
+//	      "type": "string",
+//	      "value": "required",
+//	      "param": "FILE",
+//	      "hint": "file"
+//	    },
+//	    {
+//	      "name": "v",
+//	      "flag": "-v",
+//	      "short": true,
+//	      "description": "be verbose",
+//	      "type": "bool"
+//	    }
+//	  ]
+//	}
+//
+// A flag with both a long and a short name, such as --verbose and -v, has its
+// short name in short_flag.  The value of a flag is "required" or "optional"
+// unless the flag does not take a value.  The choices are those from the
+// {choices} attribute.  The hint is "file" for flags whose parameter is named
+// FILE or PATH and "directory" for flags whose parameter is named DIR or
+// DIRECTORY.
+func CompletionSpec(opts any) ([]byte, error) {
+	descs, err := Describe(opts)
+	if err != nil {
+		return nil, err
+	}
+	spec := completionSpec{Flags: []completionFlag{}}
+	for _, d := range descs {
+		if d.Hidden {
+			continue
+		}
+		f := completionFlag{
+			Name:        d.Name,
+			Flag:        "--" + d.Name,
+			Description: d.Help,
+			Type:        d.Type,
+			Param:       d.Param,
+			Choices:     d.Choices,
+		}
+		if len(d.Name) == 1 {
+			f.Flag = "-" + d.Name
+			f.Short = true
+		}
+		if d.Short != "" {
+			f.ShortFlag = "-" + d.Short
+		}
+		switch {
+		case d.Bool:
+		case d.Optional:
+			f.Value = "optional"
+		default:
+			f.Value = "required"
+		}
+		if len(d.Choices) == 0 && !d.Bool {
+			f.Hint = valueHint(d)
+		}
+		spec.Flags = append(spec.Flags, f)
+	}
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// valueHint returns the kind of value the flag described by d takes as
+// suggested by the name of its parameter: "file", "directory", or "".
+func valueHint(d Description) string {
+	switch strings.ToUpper(d.Param) {
+	case "FILE", "PATH":
+		return "file"
+	case "DIR", "DIRECTORY":
+		return "directory"
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pborman/check"
+)
+
+func TestCompletionSpec(t *testing.T) {
+	opts := &struct {
+		Mode    string `flag:"--mode=MODE {choices=fast,slow} the mode"`
+		Config  string `flag:"--config=FILE the configuration file"`
+		Out     string `flag:"--out=DIR {optional-value=.} output directory"`
+		Verbose bool   `flag:"-v be verbose"`
+		Quiet   bool   `flag:"-q --quiet be quiet"`
+	}{}
+	data, err := CompletionSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got completionSpec
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := completionSpec{Flags: []completionFlag{{
+		Name:        "mode",
+		Flag:        "--mode",
+		Description: "the mode",
+		Type:        "string",
+		Value:       "required",
+		Param:       "MODE",
+		Choices:     []string{"fast", "slow"},
+	}, {
+		Name:        "config",
+		Flag:        "--config",
+		Description: "the configuration file",
+		Type:        "string",
+		Value:       "required",
+		Param:       "FILE",
+		Hint:        "file",
+	}, {
+		Name:        "out",
+		Flag:        "--out",
+		Description: "output directory",
+		Type:        "string",
+		Value:       "optional",
+		Param:       "DIR",
+		Hint:        "directory",
+	}, {
+		Name:        "v",
+		Flag:        "-v",
+		Short:       true,
+		Description: "be verbose",
+		Type:        "bool",
+	}, {
+		Name:        "quiet",
+		Flag:        "--quiet",
+		ShortFlag:   "-q",
+		Description: "be quiet",
+		Type:        "bool",
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%+v\nwant:\n%+v\nfrom:\n%s", got, want, data)
+	}
+
+	var raw map[string][]map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["flags"][3]["value"]; ok {
+		t.Errorf("boolean flag has a value: %v", raw["flags"][3])
+	}
+
+	_, err = CompletionSpec("bad")
+	if s := check.Error(err, "not a pointer to a struct"); s != "" {
+		t.Error(s)
+	}
+}
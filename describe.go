@@ -0,0 +1,92 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"strings"
+)
+
+// A Description describes an option declared by an options structure.
+type Description struct {
+	Name     string   // name of the flag, e.g., "name" for --name
+	Short    string   // short name of a flag that also has one, e.g., "n"
+	Field    string   // name of the field declaring the flag
+	Param    string   // name of the parameter, empty for boolean flags
+	Help     string   // the flag's description
+	Type     string   // Go type of the field, e.g., "int" or "[]string"
+	Default  string   // the default value as a string
+	Bool     bool     // the flag does not take a parameter
+	Optional bool     // the flag's parameter is optional
+	Required bool     // the flag has the {required} attribute
+	Choices  []string // the allowed values from the {choices} attribute
+	Env      string   // the environment variable from the {env} attribute
+	Hidden   bool     // the flag has the {hidden} attribute
+}
+
+// Describe returns a Description of each option declared by opts, in the
+// order they are declared.  An error is returned if opts is not a pointer to
+// a struct or contains an invalid flag tag or option type.
+//
+// Describe is intended to be used when generating documentation or
+// descriptions of options in other formats.
+func Describe(opts any) ([]Description, error) {
+	fields, err := fields(opts)
+	if err != nil {
+		return nil, err
+	}
+	descs := make([]Description, 0, len(fields))
+	for _, f := range fields {
+		o := f.tag
+		value, err := newValue(o, f.value.Addr().Interface())
+		if err != nil {
+			return nil, err
+		}
+		d := Description{
+			Name:     o.name,
+			Short:    o.short,
+			Field:    f.name,
+			Help:     o.help,
+			Type:     f.value.Type().String(),
+			Default:  value.String(),
+			Bool:     isBoolValue(value),
+			Optional: o.hasAttr("optional-value"),
+			Required: o.hasAttr("required"),
+			Choices:  o.choices(),
+			Env:      o.attrs["env"],
+			Hidden:   o.hasAttr("hidden"),
+		}
+		if def, ok := o.attrs["default"]; ok && f.value.IsZero() {
+			d.Default = def
+		}
+		if !d.Bool {
+			d.Param = o.param
+			if d.Param == "" {
+				d.Param = "VALUE"
+			}
+		}
+		descs = append(descs, d)
+	}
+	return descs, nil
+}
+
+// choices returns the list of values in the {choices} attribute of o, or nil.
+func (o *optTag) choices() []string {
+	switch {
+	case o.hasAttr("choices"):
+		return strings.Split(o.attrs["choices"], ",")
+	case o.hasAttr("oneof"):
+		return strings.Split(o.attrs["oneof"], ",")
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	opts := &struct {
+		Name    string        `flag:"--name=NAME {required} {env=NAME} the name"`
+		Mode    string        `flag:"--mode {choices=fast,slow} the mode"`
+		Verbose bool          `flag:"-v be verbose"`
+		Timeout time.Duration `flag:"--timeout"`
+		Ignored string        `flag:"-"`
+	}{
+		Mode:    "fast",
+		Timeout: time.Second,
+	}
+	got, err := Describe(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Description{{
+		Name:     "name",
+		Field:    "Name",
+		Param:    "NAME",
+		Help:     "the name",
+		Type:     "string",
+		Required: true,
+		Env:      "NAME",
+	}, {
+		Name:    "mode",
+		Field:   "Mode",
+		Param:   "VALUE",
+		Help:    "the mode",
+		Type:    "string",
+		Default: "fast",
+		Choices: []string{"fast", "slow"},
+	}, {
+		Name:    "v",
+		Field:   "Verbose",
+		Help:    "be verbose",
+		Type:    "bool",
+		Default: "false",
+		Bool:    true,
+	}, {
+		Name:    "timeout",
+		Field:   "Timeout",
+		Param:   "VALUE",
+		Type:    "time.Duration",
+		Default: "1s",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+	if _, err := Describe("bad"); err == nil {
+		t.Errorf("Describe did not return an error")
+	}
+}
+
+func TestChoices(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	opts := &struct {
+		Mode string `flag:"--mode {choices=fast,slow} the mode"`
+	}{}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--mode", "slow"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Mode != "slow" {
+		t.Errorf("got mode %q, want %q", opts.Mode, "slow")
+	}
+	var fe *FieldError
+	_, err := SubRegisterAndParse(opts, []string{"c", "--mode", "medium"})
+	if !errors.As(err, &fe) || fe.Err.Error() != "must be one of fast, slow" {
+		t.Errorf("got error %v, want must be one of fast, slow", err)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// DumpJSON writes the options in opts to w as a JSON object keyed by the
+// names of the options.  The output may be read by FileSource.
+func DumpJSON(w io.Writer, opts any) error {
+	return dumpJSON(w, nil, opts, func(value any, origin Origin) any {
+		return value
+	})
+}
+
+// DumpJSONVerbose is like DumpJSON except each option is written as an object
+// that includes where its value came from, as reported by OriginOf for set,
+// the flag set opts is registered with, e.g.:
+//
+//	{
+//	  "host": {
+//	    "value": "localhost",
+//	    "source": "env"
+//	  }
+//	}
+func DumpJSONVerbose(w io.Writer, set FlagSet, opts any) error {
+	return dumpJSON(w, set, opts, func(value any, origin Origin) any {
+		return struct {
+			Value  any    `json:"value"`
+			Source Origin `json:"source"`
+		}{value, origin}
+	})
+}
+
+// dumpJSON writes the object built by calling entry with the value and origin
+// of each option in opts to w.  The origins are those recorded by set, which
+// may be nil.
+func dumpJSON(w io.Writer, set FlagSet, opts any, entry func(value any, origin Origin) any) error {
+	fields, err := fields(opts)
+	if err != nil {
+		return err
+	}
+	m := make(map[string]any, len(fields))
+	for _, f := range fields {
+		value := f.value.Interface()
+		if v, err := newValue(f.tag, f.value.Addr().Interface()); err == nil {
+			if g, ok := v.(interface{ Get() any }); ok {
+				value = g.Get()
+			}
+		}
+		origin := OriginDefault
+		if v := lookupValue(set, f.tag.name); v != nil && v.opts == opts {
+			origin = OriginOf(set, f.tag.name)
+		}
+		m[f.tag.name] = entry(value, origin)
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(m)
+}
+
+// Args returns the command line arguments that set the options declared by
+// opts to their current values.  Options that have their default value are
+// omitted.  The default of an option is its value when opts was registered
+// with set or, if set is nil or opts is not registered with set, its {default}
+// or zero value.  A true boolean option is written as "--name" and other
+// options as "--name=value".  An []string, []int, []int64, or []float64 option is written
+// once per element.  The arguments may be parsed by SubRegisterAndParse, after
+// prepending a command name, to reproduce opts.
+func Args(set FlagSet, opts any) ([]string, error) {
+	oargs, err := optionArgs(set, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for _, a := range oargs {
+		if a.bare() {
+			args = append(args, a.name)
+		} else {
+			args = append(args, a.name+"="+a.value)
+		}
+	}
+	return args, nil
+}
+
+// WriteCommandLine writes to w a single line, starting with command, of the
+// arguments returned by Args for set and opts.  Arguments are quoted, as needed, so
+// the line may be pasted into a shell.  The value of an option with the
+// {secret} attribute is written as REDACTED unless reveal is true.
+func WriteCommandLine(w io.Writer, command string, set FlagSet, opts any, reveal bool) error {
+	oargs, err := optionArgs(set, opts, reveal)
+	if err != nil {
+		return err
+	}
+	words := []string{shellQuote(command)}
+	for _, a := range oargs {
+		switch {
+		case a.bare():
+			words = append(words, a.name)
+		case a.bool:
+			// A boolean option must have its value attached.
+			words = append(words, a.name+"="+shellQuote(a.value))
+		default:
+			words = append(words, a.name, shellQuote(a.value))
+		}
+	}
+	_, err = fmt.Fprintln(w, strings.Join(words, " "))
+	return err
+}
+
+// An optionArg is a single option, and its value, returned by optionArgs.
+type optionArg struct {
+	name  string // the flag, e.g., "--name"
+	value string
+	bool  bool // the value must be attached to the flag
+}
+
+// bare reports whether a is a true boolean option, which is written without
+// its value.
+func (a optionArg) bare() bool {
+	return a.bool && a.value == "true"
+}
+
+// optionArgs returns the options in opts that do not have their default
+// value, as described by Args for set.  The values of options with the
+// {secret} attribute are replaced with REDACTED unless reveal is true.
+func optionArgs(set FlagSet, opts any, reveal bool) ([]optionArg, error) {
+	fields, err := fields(opts)
+	if err != nil {
+		return nil, err
+	}
+	var args []optionArg
+	for _, f := range fields {
+		o := f.tag
+		value, err := newValue(o, f.value.Addr().Interface())
+		if err != nil {
+			return nil, err
+		}
+		name := "--" + o.name
+		if len(o.name) == 1 {
+			name = "-" + o.name
+		}
+		if v := lookupValue(set, o.name); v != nil && v.opts == opts {
+			if reflect.DeepEqual(f.value.Interface(), v.def.Interface()) {
+				continue
+			}
+		} else if def, ok := o.attrs["default"]; ok {
+			if value.String() == def {
+				continue
+			}
+		} else if f.value.IsZero() {
+			continue
+		}
+		redact := func(s string) string {
+			if o.hasAttr("secret") && !reveal {
+				return "REDACTED"
+			}
+			return s
+		}
+		switch value.(type) {
+		case *list:
+			// Escape commas so each element is not split.
+			for x := 0; x < f.value.Len(); x++ {
+				args = append(args, optionArg{name: name, value: redact(strings.ReplaceAll(f.value.Index(x).String(), ",", `\,`))})
+			}
+			continue
+		case *intList, *int64List, *float64List:
+			for x := 0; x < f.value.Len(); x++ {
+				args = append(args, optionArg{name: name, value: redact(fmt.Sprint(f.value.Index(x).Interface()))})
+			}
+			continue
+		}
+		if isBoolValue(value) {
+			args = append(args, optionArg{name: name, value: value.String(), bool: true})
+			continue
+		}
+		args = append(args, optionArg{name: name, value: redact(value.String()), bool: o.hasAttr("optional-value")})
+	}
+	return args, nil
+}
+
+// shellQuote returns s quoted, if needed, so a POSIX shell reads it as a
+// single word.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
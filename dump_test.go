@@ -0,0 +1,274 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pborman/check"
+)
+
+func TestDumpJSON(t *testing.T) {
+	opts := &serverOptions{Host: "localhost", Port: 80, Tags: []string{"a"}}
+	var out bytes.Buffer
+	if err := DumpJSON(&out, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "host": "localhost",
+  "name": "",
+  "port": 80,
+  "tag": [
+    "a"
+  ],
+  "timeout": 0
+}
+`
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The dumped options can be read back.
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var nopts serverOptions
+	if err := ApplyDefaults(&nopts, FileSource(path)); err != nil {
+		t.Fatal(err)
+	}
+	if nopts.Host != "localhost" || nopts.Port != 80 || len(nopts.Tags) != 1 {
+		t.Errorf("got %+v, want %+v", nopts, *opts)
+	}
+
+	if s := check.Error(DumpJSON(&out, "bad"), "not a pointer to a struct"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestDumpJSONVerbose(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	t.Setenv("TEST_HOST", "env-host")
+	t.Setenv("TEST_PORT", "80")
+	t.Setenv("TEST_TIMEOUT", "")
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"port": 8080, "tag": ["a"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := &serverOptions{Timeout: time.Second}
+	// Register and parse opts as RegisterAndParse does.
+	set := NewFlagSet("")
+	c := newParseConfig([]ParseOption{PreParse(EnvSource()), PreParse(FileSource(path))})
+	if err := c.register("c", opts, set); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.preParse(opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(set, []string{"--tag", "b"}, c); err != nil {
+		t.Fatal(err)
+	}
+	for flag, want := range map[string]Origin{
+		"host":    OriginEnv,
+		"port":    OriginFile,
+		"tag":     OriginFlag,
+		"timeout": OriginDefault,
+		"name":    OriginDefault,
+	} {
+		if got := OriginOf(set, flag); got != want {
+			t.Errorf("%s: got origin %q, want %q", flag, got, want)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := DumpJSONVerbose(&out, set, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "host": {
+    "value": "env-host",
+    "source": "env"
+  },
+  "name": {
+    "value": "",
+    "source": "default"
+  },
+  "port": {
+    "value": 8080,
+    "source": "file"
+  },
+  "tag": {
+    "value": [
+      "a",
+      "b"
+    ],
+    "source": "flag"
+  },
+  "timeout": {
+    "value": 1000000000,
+    "source": "default"
+  }
+}
+`
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	type options struct {
+		Name    string        `flag:"--name=NAME the name"`
+		V       bool          `flag:"-v be verbose"`
+		Debug   bool          `flag:"--debug enable debugging"`
+		Timeout time.Duration `flag:"--timeout=DURATION the timeout"`
+		Tags    []string      `flag:"--tag=TAG a tag"`
+		Ports   []int         `flag:"--port=PORT a port"`
+		Level   int           `flag:"--level=N {default=3} the level"`
+		Count   int           `flag:"-c {count} the count"`
+		Ignored string        `flag:"-"`
+	}
+	for _, tt := range []struct {
+		name string
+		opts options
+		want []string
+	}{{
+		name: "zero",
+		opts: options{Level: 3},
+	}, {
+		name: "all",
+		opts: options{
+			Name:    "bob smith",
+			V:       true,
+			Timeout: time.Minute,
+			Tags:    []string{"a", "b,c"},
+			Ports:   []int{80, 443},
+			Level:   5,
+			Count:   2,
+			Ignored: "x",
+		},
+		want: []string{"--name=bob smith", "-v", "--timeout=1m0s", "--tag=a", `--tag=b\,c`, "--port=80", "--port=443", "--level=5", "-c=2"},
+	}, {
+		name: "zero level",
+		opts: options{},
+		want: []string{"--level=0"},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			got, err := Args(nil, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			var parsed options
+			if _, err := SubRegisterAndParse(&parsed, append([]string{"c"}, got...)); err != nil {
+				t.Fatal(err)
+			}
+			opts.Ignored = ""
+			if !reflect.DeepEqual(parsed, opts) {
+				t.Errorf("round trip got %+v, want %+v", parsed, opts)
+			}
+		})
+	}
+	if _, err := Args(nil, "bad"); err == nil {
+		t.Errorf("did not get an error for bad options")
+	}
+
+	// The defaults of registered options are their values when
+	// registered.
+	type registered struct {
+		Count int    `flag:"--count=N the count"`
+		On    bool   `flag:"--on turn it on"`
+		Name  string `flag:"--name=NAME the name"`
+	}
+	opts := &registered{Count: 42, On: true}
+	set := NewFlagSet("")
+	if err := RegisterSet("c", opts, set); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Args(set, opts); err != nil || got != nil {
+		t.Errorf("got %q, %v, want none", got, err)
+	}
+	if err := parse(set, []string{"--on=false", "--name=bob"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Args(set, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--on=false", "--name=bob"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	parsed := &registered{Count: 42, On: true}
+	if _, err := SubRegisterAndParse(parsed, append([]string{"c"}, got...)); err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != *opts {
+		t.Errorf("round trip got %+v, want %+v", *parsed, *opts)
+	}
+
+	// Without the set the defaults are the zero values.
+	got, err = Args(nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--count=42", "--name=bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteCommandLine(t *testing.T) {
+	type options struct {
+		Name     string   `flag:"--name=NAME the name"`
+		Debug    bool     `flag:"--debug enable debugging"`
+		Color    bool     `flag:"--color {default=true} use color"`
+		Tags     []string `flag:"--tag=TAG a tag"`
+		Password string   `flag:"--password=PASSWORD {secret} the password"`
+	}
+	opts := &options{
+		Name:     "bob's app",
+		Debug:    true,
+		Tags:     []string{"a", "b c"},
+		Password: "hunter2",
+	}
+	for _, tt := range []struct {
+		reveal bool
+		want   string
+	}{
+		{false, `my-cmd --name 'bob'\''s app' --debug --color=false --tag a --tag 'b c' --password REDACTED` + "\n"},
+		{true, `my-cmd --name 'bob'\''s app' --debug --color=false --tag a --tag 'b c' --password hunter2` + "\n"},
+	} {
+		var out bytes.Buffer
+		if err := WriteCommandLine(&out, "my-cmd", nil, opts, tt.reveal); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("reveal %v: got %s, want %s", tt.reveal, got, tt.want)
+		}
+	}
+
+	var help bytes.Buffer
+	Help(&help, "my-cmd", "", opts)
+	if strings.Contains(help.String(), "hunter2") {
+		t.Errorf("help displayed a secret:\n%s", &help)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// defaultFetchTimeout is the timeout of a {fetch} option that does not
+// declare one.
+const defaultFetchTimeout = 30 * time.Second
+
+var (
+	httpClientMu sync.Mutex
+	httpClient   *http.Client
+)
+
+// SetHTTPClient sets the client used to fetch the values of options with the
+// {fetch} attribute.  Passing nil restores the default, http.DefaultClient.
+// SetHTTPClient is normally used by tests.
+func SetHTTPClient(c *http.Client) {
+	httpClientMu.Lock()
+	httpClient = c
+	httpClientMu.Unlock()
+}
+
+// getHTTPClient returns the client set by SetHTTPClient.
+func getHTTPClient() *http.Client {
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+	if httpClient == nil {
+		return http.DefaultClient
+	}
+	return httpClient
+}
+
+// A fetched is a string or []string set from the body of a URL.  A string is
+// set to the body and the non-empty lines of the body are appended to an
+// []string.
+type fetched struct {
+	str     *string
+	lines   *[]string
+	timeout time.Duration
+	url     string // the URL most recently fetched
+}
+
+// newFetched returns a fetched that sets opt, as declared by the {fetch}
+// attribute in o.  The attribute's value, if any, is the timeout, e.g.,
+// {fetch=10s}.
+func newFetched(o *optTag, opt any) (Value, error) {
+	f := &fetched{timeout: defaultFetchTimeout}
+	switch p := opt.(type) {
+	case *string:
+		f.str = p
+	case *[]string:
+		f.lines = p
+	default:
+		return nil, fmt.Errorf("{fetch} requires a string or []string, not %v", reflect.TypeOf(opt).Elem())
+	}
+	if s := o.attrs["fetch"]; s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("{fetch} requires a positive timeout: %q", s)
+		}
+		f.timeout = d
+	}
+	return f, nil
+}
+
+func (f *fetched) Set(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := getHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %v", url, err)
+	}
+	if f.str != nil {
+		*f.str = string(body)
+	} else {
+		s := bufio.NewScanner(bytes.NewReader(body))
+		for s.Scan() {
+			if line := s.Text(); line != "" {
+				*f.lines = append(*f.lines, line)
+			}
+		}
+	}
+	f.url = url
+	return nil
+}
+
+// String returns the URL most recently fetched.
+func (f *fetched) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.url
+}
+
+func (f *fetched) Get() any {
+	if f.str != nil {
+		return *f.str
+	}
+	return *f.lines
+}
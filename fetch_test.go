@@ -0,0 +1,105 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pborman/check"
+)
+
+// A fakeTransport maps URLs to the bodies it returns for them.
+type fakeTransport map[string]string
+
+func (t fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := t[req.URL.String()]
+	if !ok {
+		if req.URL.Host == "down.example.com" {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Status:     "404 Not Found",
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func TestFetch(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	defer SetHTTPClient(nil)
+	SetHTTPClient(&http.Client{Transport: fakeTransport{
+		"https://example.com/rules.txt": "allow a\n\ndeny b\n",
+	}})
+	type options struct {
+		Rules []string `flag:"--rules=URL {fetch} the rules"`
+		Text  string   `flag:"--text=URL {fetch=5s} the text"`
+	}
+	opts := &options{}
+	args := []string{"c", "--rules", "https://example.com/rules.txt", "--text", "https://example.com/rules.txt"}
+	if _, err := SubRegisterAndParse(opts, args); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"allow a", "deny b"}; !reflect.DeepEqual(opts.Rules, want) {
+		t.Errorf("got rules %q, want %q", opts.Rules, want)
+	}
+	if want := "allow a\n\ndeny b\n"; opts.Text != want {
+		t.Errorf("got text %q, want %q", opts.Text, want)
+	}
+
+	for _, tt := range []struct {
+		url string
+		err string
+	}{
+		{url: "https://example.com/missing.txt", err: `invalid value "https://example.com/missing.txt" for flag -rules: fetching https://example.com/missing.txt: 404 Not Found`},
+		{url: "https://down.example.com/rules.txt", err: "connection refused"},
+	} {
+		_, err := SubRegisterAndParse(&options{}, []string{"c", "--rules", tt.url})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s: %s", tt.url, s)
+		}
+	}
+
+	for _, tt := range []struct {
+		opts any
+		err  string
+	}{{
+		opts: &struct {
+			Rules int `flag:"--rules {fetch}"`
+		}{},
+		err: "{fetch} requires a string or []string, not int",
+	}, {
+		opts: &struct {
+			Rules string `flag:"--rules {fetch=soon}"`
+		}{},
+		err: `{fetch} requires a positive timeout: "soon"`,
+	}} {
+		_, err := SubRegisterAndParse(tt.opts, []string{"c"})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Error(s)
+		}
+	}
+}
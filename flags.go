@@ -43,6 +43,16 @@
 // option declarations, everything following is the description.  This enables
 // the description to start with a -, e.g. "-v -- -v means verbose".
 //
+// An option may have both a long name and a short name, e.g.,
+// "-v --verbose be verbose".  Either name may be used on the command line.
+//
+// Attributes may follow the option declaration.  Attributes are enclosed in
+// braces and select special handling of the option, e.g.:
+//
+//	"--cpus=LIST {ranges} the cpus to use"
+//
+// A description that starts with a { must be preceded by --.
+//
 // # Example Tags
 //
 // The following are example tags
@@ -50,6 +60,7 @@
 //	"--name=NAME sets the name to NAME"
 //	"-n=NAME     sets the name to NAME"
 //	"--name      sets the name"
+//	"-n --name=NAME sets the name to NAME"
 //
 // A tag of just "-" causes the field to be ignored an not used as an option.
 // An empty tag or missing tag causes the tag to be auto-generated.
@@ -57,21 +68,211 @@
 //	Name string -> "--name unspecified"
 //	N int       -> "-n unspecified"
 //
+// # Option Groups
+//
+// A structure field whose tag is just a name, without dashes, declares a
+// group of options.  The options declared by the fields of the structure are
+// prefixed by the name and a period:
+//
+//	type TLSOptions struct {
+//		Cert string `flag:"--cert=PATH the certificate"`
+//		Key  string `flag:"--key=PATH the private key"`
+//	}
+//
+//	TLS TLSOptions `flag:"tls"`  // declares --tls.cert and --tls.key
+//
+// Groups may be nested.  Options within a group may not have short names.
+//
+// The options declared by an embedded structure without a flag tag are
+// declared as if the fields of the embedded structure were fields of the
+// structure embedding it, e.g.:
+//
+//	type CommonFlags struct {
+//		Verbose bool `flag:"-v be verbose"`
+//	}
+//
+//	opts := &struct {
+//		CommonFlags               // declares -v
+//		Extra string `flag:"--extra=VALUE an extra option"`
+//	}{}
+//
+// It is an error for two fields to declare the same flag name.
+//
+// # Positional Arguments
+//
+// A field with an arg tag, rather than a flag tag, declares a positional
+// argument.  After parsing, positional arguments are set from the arguments
+// remaining after the flags, in the order they are declared.  The arg tag
+// names the argument and optionally describes it:
+//
+//	Src   string   `arg:"SRC the source"`         // required
+//	Dst   string   `arg:"[DST] the destination"`  // optional
+//	Extra []string `arg:"[EXTRA...] more files"`  // the remaining arguments
+//
+// Positional arguments are included in the usage line produced by UsageLine
+// and Help, e.g., "cmd [-v] SRC [DST] [EXTRA...]".
+//
 // # Types
 //
 // The fields of the structure must be compatible with one of the folllowing
 // types:
 //
 //	bool
-//	int
-//	int64
-//	float64
+//	int, int8, int16, int32, int64
+//	float32, float64
 //	string
-//	uint
-//	uint64
-//	[]string
+//	uint, uint8, uint16, uint32, uint64
+//	[]string, []int, []int64, []float64
+//	map[string]string
 //	Value
 //	time.Duration
+//	*big.Int
+//	*url.URL
+//	Port
+//	net.IP, net.IPNet
+//	atomic.Bool, atomic.Int32, atomic.Int64, atomic.Uint32, atomic.Uint64
+//
+// Each time an []string option is set the value is appended to the list.
+// A value containing commas appends each comma separated element, e.g.,
+// "--list a,b --list c" sets the list to a, b, and c.  Use "\," for a comma
+// within an element.  Positional arguments and values provided by a Source
+// are not split.
+//
+// Each time a map[string]string option is set the key=value pairs in the
+// value are added to the map, e.g., "--label env=prod --label team=search".
+// As with an []string, a value containing commas is a list of pairs.
+//
+// Fields whose type is a named type of one of the above types, such as
+// "type Env string", are treated as the underlying type.
+//
+// Fields of the sync/atomic types are set using their Store method so they may
+// be safely read concurrently after parsing.
+//
+// The following attributes are supported:
+//
+//	{ranges}     An []int set from a list of numbers and ranges, e.g., "0-3,5".
+//	{multiline}  A string that, when set to "-", reads all of standard input.
+//	{fromdir}    An []string set to the lines of the files in a directory.
+//	{glob}       An []string that appends the paths matching a glob pattern,
+//	             e.g., --files '*.go'.  A pattern must match a path.
+//	{glob-allow-empty}
+//	             A {glob} whose patterns may match nothing.
+//	{jsonl}      A slice set from a JSON Lines file, e.g., --records @in.jsonl.
+//	             Each line of the file is unmarshaled into a new element.
+//	{kv-struct}  A slice of structures that appends an element each time it
+//	             is set from a list of key=value pairs, e.g., src=a,dst=b.
+//	             The keys are the options declared by the structure.
+//	{any-port}   A Port that may also be set to 0.
+//	{flags=A:1,B:2,...}
+//	             A uint set from a list of the names A, B, ..., e.g.,
+//	             --features a,b.  The bits of the names are OR'd together.
+//	{struct}     A structure set from a list of key=value pairs, e.g.,
+//	             --backend type=s3,region=us-east-1.  The keys are the
+//	             options declared by the structure.
+//	{keep-last=N}
+//	             An []string that keeps only the last N values it is set to.
+//	{ring=N}     An []string used as a ring buffer of N values.  Once full,
+//	             each value overwrites the oldest value in place.
+//	{dedup}      An []string that discards values it already contains.
+//	{default=VALUE}
+//	             The option is set to VALUE when it is registered if its
+//	             field has the zero value, e.g., {default=3}.
+//	{deprecated} The flag is deprecated.  A warning is generated when it is
+//	             used.  See Warnings.  The flag is marked as deprecated by
+//	             Help and is omitted from the usage line.
+//	{deprecated=FLAG}
+//	             The flag is deprecated in favor of FLAG, e.g., --new-name.
+//	{hidden}     The flag is not displayed by Help, the usage line, or the
+//	             generated documentation and completions, but is otherwise a
+//	             normal flag.
+//	{help-file=PATH}
+//	             The help text of the option is read from the file PATH in the
+//	             file system set by SetHelpFS.
+//	{help-flag}  The option is the program's own help option and may be named
+//	             help or h, which otherwise conflict with the help flag built
+//	             into the flag package.
+//	{env=NAME}   The environment variable NAME provides the default value of
+//	             the option.  A field may also have an env tag instead,
+//	             e.g., `env:"NAME"`.  See Environment Variables below.
+//	{negatable}  A bool that also declares --no-NAME, which sets the option to
+//	             false, e.g., --verbose and --no-verbose.  The last one used
+//	             wins.  Help does not list --no-NAME separately.
+//	{optional-value=VALUE}
+//	             The flag's parameter is optional.  The flag is set to VALUE
+//	             when no parameter is attached, e.g., --color rather than
+//	             --color=always.  The following argument is never consumed.
+//	{fetch}      A string set to the body of a URL, or an []string that
+//	             appends the non-empty lines of the body, e.g.,
+//	             --rules https://example.com/rules.txt.  See SetHTTPClient.
+//	{fetch=TIMEOUT}
+//	             A {fetch} whose request times out after TIMEOUT, e.g., 10s,
+//	             rather than 30s.
+//	{flag-count} An int that is set to the number of flags set on the command
+//	             line.  The field does not declare an option and the tag
+//	             contains only the attribute: `flag:"{flag-count}"`.
+//	{raw-of=FLAG}
+//	             A string that is set to the text FLAG was last set to, e.g.,
+//	             "1.5h" rather than the time.Duration 90m.  The field does not
+//	             declare an option and the tag contains only the attribute:
+//	             `flag:"{raw-of=timeout}"`.
+//	{preset=FLAG:VALUE}
+//	             A bool that, when set to true, also sets FLAG to VALUE.
+//	{sum}        A time.Duration set to the sum of a list of durations, e.g.,
+//	             "1h,30m,15s" is 1h45m15s.
+//	{clock}      A time.Duration that may also be set as HH:MM:SS, MM:SS, or SS.
+//	{count}      An int incremented each time the flag is used, e.g., -v -v.
+//	             A single character flag may be repeated, e.g., -vvv.
+//	{count=N}    A {count} that does not exceed N, e.g., -vvvv is 3 with
+//	             {count=3}.  {min} and {max} may not be used with {count}.
+//	{min=N}      A number that must be at least N, e.g., --workers=0 is
+//	             rejected with {min=1}.
+//	{max=N}      A number that must be at most N.
+//	{choices=A,B,...}
+//	             The value must be one of A, B, ....  Help lists the
+//	             choices.  A {default} that is not a choice is an error.
+//	{oneof=A,B,...}
+//	             The same as {choices=A,B,...}.
+//	{required}   The flag must be set on the command line, from its
+//	             environment variable, or by a Source.  Parsing returns an
+//	             error naming every required flag that is not set.
+//	{together=GROUP}
+//	             The options in GROUP must be set together or not at all,
+//	             e.g., --username and --password.  As with {required}, an
+//	             option is set by the command line, environment, or a Source.
+//	{secret}     The value of the option is not displayed by Help and is
+//	             written as REDACTED by WriteCommandLine.
+//	{section=NAME}
+//	             Help displays the option in the section headed by NAME.
+//	             Within a section options are displayed in the order they are
+//	             declared.  Options without a section are displayed first.
+//	{sorted}     An []string whose values are kept sorted.  {sorted} and
+//	             {dedup} may not be used with {keep-last} or {ring}.
+//	{pem}        A *x509.Certificate or tls.Certificate read from a PEM file,
+//	             e.g., --cert @server.pem.  A tls.Certificate's file must
+//	             also contain the private key.
+//	{validate=NAME}
+//	             Values are validated by the validator NAME before being set.
+//	             See RegisterValidator.
+//	{validate-any=NAME,...}
+//	             Values must be accepted by at least one of the validators
+//	             NAME, ....  The error lists why each validator failed.
+//
+// # Environment Variables
+//
+// An option with an {env=NAME} attribute, or an `env:"NAME"` tag, is set
+// from the environment variable NAME when it is registered if NAME is set to
+// a non-empty value.  The value of an option is determined by, from highest to
+// lowest precedence:
+//
+//   - the command line
+//   - a Source, such as FileSource, applied after the option was registered,
+//     such as by PreParse
+//   - the environment variable NAME
+//   - the value of the field when it was registered
+//
+// An invalid value in the environment variable is reported when the command
+// line is parsed, as an invalid value on the command line would be, unless the
+// option is set on the command line.
 //
 // # Example Structure
 //
@@ -116,13 +317,17 @@
 package flags
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pborman/indent"
@@ -135,6 +340,14 @@ type Value interface {
 	Set(string) error
 }
 
+// A Decoder is an option type that needs additional context to decode its
+// value.  The ctx passed to Decode is the ctx passed to RegisterSetContext,
+// or nil if the option was registered some other way.  An option type that
+// implements both Value and Decoder is treated as a Value.
+type Decoder interface {
+	Decode(ctx any, s string) error
+}
+
 // NewFlagSet and CommandLine can be replaced to use a different flag package.
 // They default to the standard flag package.
 var (
@@ -151,7 +364,18 @@ var output io.Writer
 //	Var(v valueType, name, usage string)
 //
 // Where valueType implements the Value interface (which flag.Value does).
-// We cannot put Var in the interface due to the Value type.
+// We cannot put Var in the interface due to the Value type.  Options of the
+// basic types, such as string and int, are defined with the typed methods,
+// e.g., StringVar, and all other options with Var.
+//
+// Features such as FieldError, {required}, WasSet, and Warnings also need the
+// FlagSet to have the methods
+//
+//	Lookup(name string) *flag.Flag
+//	VisitAll(fn func(*flag.Flag))
+//
+// as flag.FlagSet does.  The information about the options registered with the
+// FlagSet is kept by the Values of its flags and found through these methods.
 type FlagSet interface {
 	Parse([]string) error
 	Args() []string
@@ -167,6 +391,7 @@ type FlagSet interface {
 	BoolVar(p *bool, name string, value bool, usage string)
 }
 
+// A list is an []string that is appended to each time it is set.
 type list []string
 
 func (l *list) Set(s string) error {
@@ -174,12 +399,53 @@ func (l *list) Set(s string) error {
 	return nil
 }
 
+// A splitValue is a Value that sets its Value to each of the comma separated
+// elements of a value, e.g., "a,b" sets "a" and then "b".  An escaped comma,
+// "\,", is a literal comma.  Only the []string options registered as flags
+// are split, not positional arguments or values from a Source.
+type splitValue struct {
+	Value
+}
+
+func (v *splitValue) Set(s string) error {
+	for _, e := range splitList(s) {
+		if err := v.Value.Set(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *splitValue) Get() any {
+	return getValue(v.Value)
+}
+
+// splitList splits s at each comma that is not preceded by a backslash and
+// replaces each escaped comma with a comma.
+func splitList(s string) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == ',':
+			part.WriteByte(',')
+			i++
+		case s[i] == ',':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(s[i])
+		}
+	}
+	return append(parts, part.String())
+}
+
 func (l *list) String() string {
 	return strings.Join(*l, " ")
 }
 
 func (l *list) Get() any {
-	return *l
+	return []string(*l)
 }
 
 // Dup returns a shallow duplicate of i or panics.  Dup panics if i is not a
@@ -197,27 +463,54 @@ func Dup(i any) any {
 	if v.Kind() != reflect.Struct {
 		panic(fmt.Errorf("%T is not a pointer to a struct", i))
 	}
-	t := v.Type()
-	newi := reflect.New(t) // Same type as i
-	ret := newi.Interface()
-	newi = newi.Elem()
+	newi := reflect.New(v.Type()) // Same type as i
+	dup(newi.Elem(), v, false)
+	return newi.Interface()
+}
+
+// deepDup is like Dup except the slices and maps in i are copied rather than
+// shared, so that setting the options in the duplicate never modifies i.  i
+// must be a pointer to a struct.  Unlike Dup, deepDup does not check the flag
+// tags of i.
+func deepDup(i any) any {
+	v := reflect.ValueOf(i).Elem()
+	newi := reflect.New(v.Type())
+	dup(newi.Elem(), v, true)
+	return newi.Interface()
+}
 
+// dup copies the fields of the structure src to dst, as described by Dup.
+// Slices and maps are copied, see copyValue, if deep is true.
+func dup(dst, src reflect.Value, deep bool) {
+	t := src.Type()
 	n := t.NumField()
 	for i := 0; i < n; i++ {
 		field := t.Field(i)
-		fv := newi.Field(i)
+		fv := dst.Field(i)
 		tag := field.Tag.Get("flag")
+		if isEmbedded(field) {
+			dup(fv, src.Field(i), deep)
+			continue
+		}
 		if tag == "-" || !fv.CanSet() {
 			continue
 		}
-		_, err := parseTag(tag)
-		if err != nil {
-			panic(err)
+		if groupOf(field) != "" {
+			dup(fv, src.Field(i), deep)
+			continue
+		}
+		if !deep && !nonOption(field) {
+			if _, err := parseTag(tag); err != nil {
+				panic(err)
+			}
 		}
 		// Copy the value over
-		fv.Set(v.Field(i))
+		if deep {
+			fv.Set(copyValue(src.Field(i)))
+		} else {
+			fv.Set(src.Field(i))
+		}
 	}
-	return ret
 }
 
 // Register registers the fields in i with the standard command-line option set.
@@ -229,13 +522,43 @@ func Register(i any) {
 }
 
 // RegisterAndParse and calls Register(i), flag.Parse(), and returns
-// flag.Args().
-func RegisterAndParse(i any) ([]string, error) {
-	Register(i)
-	err := CommandLine.Parse(os.Args[1:])
+// flag.Args().  The options in opts, such as PreParse, modify how the command
+// line is parsed.
+func RegisterAndParse(i any, opts ...ParseOption) ([]string, error) {
+	c := newParseConfig(opts)
+	if err := c.register("", i, CommandLine); err != nil {
+		panic(err)
+	}
+	if err := c.preParse(i); err != nil {
+		return nil, err
+	}
+	err := parse(CommandLine, os.Args[1:], c)
 	return CommandLine.Args(), err
 }
 
+// RegisterAndParseFile is like RegisterAndParse except the options in i are
+// set from the JSON object in the file path, as with FileSource, after i is
+// registered, so the file provides defaults that override the environment and
+// that the command line overrides.  The keys of the object are the names of
+// the options or of their fields.  If optional is true a missing file is not
+// an error.  A file that cannot be read or is malformed is always an error.
+func RegisterAndParseFile(i any, path string, optional bool, opts ...ParseOption) ([]string, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		file := PreParse(func(opts any) error {
+			if err := setJSON(opts, data); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			return nil
+		})
+		opts = append([]ParseOption{file}, opts...)
+	case !optional || !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	return RegisterAndParse(i, opts...)
+}
+
 // SubRegisterAndParse is similar to RegisterAndParse except it is provided the
 // arguments as args and on error the error is returned rather than written to
 // standard error and the exiting the program.  This is done by creating a new
@@ -243,7 +566,8 @@ func RegisterAndParse(i any) ([]string, error) {
 // with args.
 //
 // SubRegisterAndParse is useful when you want to parse arguments other than
-// os.Args (which is what RegisterAndParse does).
+// os.Args (which is what RegisterAndParse does).  The options in opts modify
+// how args are parsed, as with RegisterAndParse.
 //
 // The first element of args is equivalent to a command name and is not parsed.
 //
@@ -265,18 +589,112 @@ func RegisterAndParse(i any) ([]string, error) {
 //		fmt.Printf("The name is %s\n", opts.Name)
 //		fmt.Printf("The parameters are: %q\n", args)
 //	}
-func SubRegisterAndParse(i any, args []string) ([]string, error) {
+func SubRegisterAndParse(i any, args []string, opts ...ParseOption) ([]string, error) {
 	if len(args) == 0 {
 		return nil, nil
 	}
 	set := NewFlagSet("")
-	if err := RegisterSet(args[0], i, set); err != nil {
+	c := newParseConfig(opts)
+	if err := c.register(args[0], i, set); err != nil {
+		return nil, err
+	}
+	if output != nil {
+		set.SetOutput(output)
+	}
+	if err := c.preParse(i); err != nil {
+		return nil, err
+	}
+	if err := parse(set, args[1:], c); err != nil {
+		return nil, err
+	}
+	return set.Args(), nil
+}
+
+// SplitAtTerminator splits args at the first "--".  before contains the
+// arguments preceding the "--" and after contains the arguments following it.
+// If args does not contain "--" then before is args and after is nil.
+func SplitAtTerminator(args []string) (before, after []string) {
+	for x, arg := range args {
+		if arg == "--" {
+			return args[:x], args[x+1:]
+		}
+	}
+	return args, nil
+}
+
+// SubRegisterAndParseCommand is like SubRegisterAndParse except only the
+// arguments preceding the first "--" in args are parsed.  The remaining
+// arguments from the parse are returned in rest and the arguments following
+// the "--", typically another command and its arguments, are returned
+// unmodified in command.  As an example, with args of
+//
+//	tool --global file -- subcmd --sub
+//
+// the --global flag is set, rest is "file", and command is "subcmd --sub".
+func SubRegisterAndParseCommand(i any, args []string, opts ...ParseOption) (rest, command []string, err error) {
+	if len(args) == 0 {
+		return nil, nil, nil
+	}
+	before, after := SplitAtTerminator(args[1:])
+	rest, err = SubRegisterAndParse(i, append([]string{args[0]}, before...), opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rest, after, nil
+}
+
+// TryParse reports whether args, which do not include a command name, would
+// parse successfully as the options declared by i.  The arguments are parsed
+// into a copy of i, see Dup, whose slices and maps are also copied, so i is
+// never modified.  The options in opts modify how args are parsed, as with
+// RegisterAndParse.
+//
+// TryParse is useful for checking a new set of arguments, such as when
+// reloading a configuration, before applying them.
+func TryParse(i any, args []string, opts ...ParseOption) error {
+	if _, _, err := allFields(i); err != nil {
+		return err
+	}
+	i = deepDup(i)
+	set := NewFlagSet("")
+	set.SetOutput(io.Discard)
+	c := newParseConfig(opts)
+	if err := c.register("", i, set); err != nil {
+		return err
+	}
+	if err := c.preParse(i); err != nil {
+		return err
+	}
+	return parse(set, args, c)
+}
+
+// An AnnotatedArg is a command line argument along with whether it was
+// quoted, such as by a user interface that tracks how the arguments were
+// entered.
+type AnnotatedArg struct {
+	Arg    string
+	Quoted bool
+}
+
+// ParseAnnotated registers i with a new FlagSet and parses args, which do not
+// include a command name, as with SubRegisterAndParse.  The value of an
+// []string option that was quoted is not split at commas, e.g., a quoted
+// "a,b" appends "a,b" while an unquoted a,b appends "a" and "b".  The
+// remaining arguments are returned.  As with SubRegisterAndParse, the flag set
+// is discarded when ParseAnnotated returns.
+func ParseAnnotated(i any, args []AnnotatedArg, opts ...ParseOption) ([]string, error) {
+	set := NewFlagSet("")
+	c := newParseConfig(opts)
+	if err := c.register("", i, set); err != nil {
 		return nil, err
 	}
 	if output != nil {
 		set.SetOutput(output)
 	}
-	if err := set.Parse(args[1:]); err != nil {
+	if err := c.preParse(i); err != nil {
+		return nil, err
+	}
+	if err := parse(set, quotedArgs(c.info, args), c); err != nil {
 		return nil, err
 	}
 	return set.Args(), nil
@@ -284,28 +702,120 @@ func SubRegisterAndParse(i any, args []string) ([]string, error) {
 
 // Parse calls flag.Parse and returns flag.Args().
 func Parse() ([]string, error) {
-	err := CommandLine.Parse(os.Args[1:])
+	err := parse(CommandLine, os.Args[1:], nil)
 	return CommandLine.Args(), err
 }
 
-// Validate validates i as a set of options or returns an error.
+// Validate validates i as a set of options or panics.  See ValidateError.
 //
 // Use Validate to assure that a later call to one of the Register functions
 // will not panic.  Validate is typically called by an init function on
 // structures that will be registered later.
 func Validate(i any) {
-	set := NewFlagSet("")
-	if err := register("", i, set); err != nil {
+	if err := ValidateError(i); err != nil {
 		panic(err)
 	}
 }
 
+// ValidateError is like Validate but returns an error, such as i not being a
+// pointer to a struct or having an invalid flag tag or option type, rather
+// than panicking.  A TagErrors is returned if i has more than one problem.
+func ValidateError(i any) error {
+	if _, _, err := allFields(i); err != nil {
+		return err
+	}
+	set := NewFlagSet("")
+	// Register a copy of i as registering sets options from the
+	// environment.
+	return register("", deepDup(i), set)
+}
+
+// ValidateShorts reports every short (single character) flag name that is
+// declared more than once across the option structures in opts.  It also
+// reports any errors in the structures themselves.  ValidateShorts is intended
+// to be called on option structures that will later be registered together.
+func ValidateShorts(opts ...any) []error {
+	type decl struct {
+		field string
+		arg   int
+	}
+	var errs []error
+	seen := map[string]decl{}
+	for x, i := range opts {
+		fields, err := fields(i)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, f := range fields {
+			short := f.tag.short
+			if len(f.tag.name) == 1 {
+				short = f.tag.name
+			}
+			if short == "" {
+				continue
+			}
+			d := decl{field: f.name, arg: x + 1}
+			if prev, ok := seen[short]; ok {
+				errs = append(errs, fmt.Errorf("short flag -%s declared by %s (argument %d) and %s (argument %d)", short, prev.field, prev.arg, d.field, d.arg))
+				continue
+			}
+			seen[short] = d
+		}
+	}
+	return errs
+}
+
+// CheckParams reports the options in opts whose parameter names, such as
+// VALUE in "--name=VALUE", are not in upper case, or that take a value but do
+// not declare a parameter name.  It also reports an error in opts itself.
+// CheckParams is intended to be used by tests to keep the output of Help
+// consistent.
+func CheckParams(opts any) []string {
+	fields, err := fields(opts)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	for _, f := range fields {
+		o := f.tag
+		flag := "--" + o.name
+		if len(o.name) == 1 {
+			flag = "-" + o.name
+		}
+		if o.param != "" {
+			if o.param != strings.ToUpper(o.param) {
+				problems = append(problems, fmt.Sprintf("%s: parameter %s is not upper case", flag, o.param))
+			}
+			continue
+		}
+		if value, _ := newValue(o, f.value.Addr().Interface()); !isBoolValue(value) {
+			problems = append(problems, fmt.Sprintf("%s: takes a value but has no parameter name", flag))
+		}
+	}
+	return problems
+}
+
 // RegisterNew creates a new flag.FlagSet, duplicates i, calls RegisterSet, and
 // then returns them.  RegisterNew should be used when the options in i might be
 // parsed multiple times requiring a new instance of i each time.
 func RegisterNew(name string, i any) (any, FlagSet) {
 	set := NewFlagSet("")
-	i = Dup(i)
+	i = deepDup(i)
+	if err := register(name, i, set); err != nil {
+		panic(err)
+	}
+	return i, set
+}
+
+// RegisterNewT creates a new flag.FlagSet and a new zero valued T, calls
+// RegisterSet, and returns them.  RegisterNewT is similar to RegisterNew but
+// returns a *T rather than requiring a type assertion.  Defaults must be set
+// in the returned *T prior to parsing.  RegisterNewT panics if T is not a
+// struct or has an invalid flag tag.
+func RegisterNewT[T any](name string) (*T, FlagSet) {
+	set := NewFlagSet("")
+	i := new(T)
 	if err := register(name, i, set); err != nil {
 		panic(err)
 	}
@@ -326,64 +836,306 @@ func RegisterSet(name string, i any, set FlagSet) error {
 	return register(name, i, set)
 }
 
-func register(name string, i any, set FlagSet) error {
-	v := reflect.ValueOf(i)
-	if v.Kind() != reflect.Ptr {
-		return fmt.Errorf("%T is not a pointer to a struct", i)
+// RegisterSetMapped is like RegisterSet but also returns a map from the name
+// of each field in i that declares an option to the *flag.Flag registered for
+// it.  The flags may be further decorated, such as by changing their Usage.
+// An error is returned if set does not have a Lookup method, as
+// *flag.FlagSet does.
+func RegisterSetMapped(i any, set FlagSet) (map[string]*flag.Flag, error) {
+	lookup, ok := set.(interface{ Lookup(string) *flag.Flag })
+	if !ok {
+		return nil, fmt.Errorf("%T does not have a Lookup method", set)
 	}
-	v = v.Elem()
-	if v.Kind() != reflect.Struct {
-		return fmt.Errorf("%T is not a pointer to a struct", i)
+	before := 0
+	if info := lookupSetInfo(set); info != nil {
+		before = len(info.values)
 	}
-	t := v.Type()
+	info, err := registerContext(nil, "", i, set, false)
+	if err != nil {
+		return nil, err
+	}
+	values := info.values[before:]
+	m := make(map[string]*flag.Flag, len(values))
+	for _, v := range values {
+		m[v.field] = lookup.Lookup(v.name)
+	}
+	return m, nil
+}
 
-	n := t.NumField()
-	for i := 0; i < n; i++ {
-		field := t.Field(i)
-		fv := v.Field(i)
-		tag := field.Tag.Get("flag")
-		if tag == "-" || !fv.CanSet() {
-			continue
+// RegisterSetContext is like RegisterSet except ctx is passed to the Decode
+// method of each field in i that implements Decoder.  ctx may be anything,
+// such as a logger or registry, needed by the fields to decode their values.
+func RegisterSetContext(ctx any, name string, i any, set FlagSet) error {
+	_, err := registerContext(ctx, name, i, set, false)
+	return err
+}
+
+// checkHelpName returns an error if name, a name of the option declared by o,
+// conflicts with the built-in help flag.  userHelp permits the names of all
+// the options, as with NoBuiltinHelp.
+func checkHelpName(o *optTag, name string, userHelp bool) error {
+	if !userHelp && !o.hasAttr("help-flag") && (name == "help" || name == "h") {
+		return fmt.Errorf("flag name '%s' conflicts with the built-in help flag; use a different name or disable the built-in", name)
+	}
+	return nil
+}
+
+// checkDuplicates returns an error if any of the names of the flags declared by
+// fields are already defined in the set described by info, such as by another
+// options structure.  fields has already been checked for duplicates.
+func checkDuplicates(info *setInfo, fields []field) error {
+	lookup, _ := info.set.(interface{ Lookup(string) *flag.Flag })
+	for _, f := range fields {
+		for _, name := range []string{f.tag.name, f.tag.short} {
+			if name == "" {
+				continue
+			}
+			if v := info.lookup(name); v != nil {
+				return fmt.Errorf("duplicate flag name %q on fields %s and %s", name, v.field, f.name)
+			}
+			if lookup != nil && lookup.Lookup(name) != nil {
+				return fmt.Errorf("duplicate flag name %q on field %s", name, f.name)
+			}
+		}
+	}
+	return nil
+}
+
+func register(name string, i any, set FlagSet) error {
+	_, err := registerContext(nil, name, i, set, false)
+	return err
+}
+
+// registerContext registers i with set, passing ctx to the Decode method of
+// the fields of i, and returns the information about set.  userHelp permits
+// options named help or h, see NoBuiltinHelp.
+func registerContext(ctx any, name string, i any, set FlagSet, userHelp bool) (*setInfo, error) {
+	fields, errs, err := allFields(i)
+	if err != nil {
+		return nil, err
+	}
+	args, err := positionals(i)
+	if err != nil {
+		return nil, err
+	}
+	info := lookupSetInfo(set)
+	if info == nil {
+		info = &setInfo{set: set}
+	}
+	if info.isFrozen() {
+		return nil, errFrozen
+	}
+	raws, err := rawFields(i)
+	if err != nil {
+		return nil, err
+	}
+	for name := range raws {
+		if findField(fields, name) == nil && errs == nil {
+			return nil, fmt.Errorf("{raw-of=%s} names an unknown flag", name)
 		}
-		o, err := parseTag(tag)
+	}
+	if err := checkDuplicates(info, fields); err != nil && errs == nil {
+		return nil, err
+	}
+	counts, err := flagCountFields(i)
+	if err != nil {
+		return nil, err
+	}
+	// Nothing is registered with set unless all the fields are valid.
+	values := make([]*flagValue, 0, len(fields))
+	for _, f := range fields {
+		v, err := newFlagValue(ctx, info, i, f, raws, userHelp)
 		if err != nil {
+			errs = append(errs, &TagError{Field: f.name, Err: err})
+			continue
+		}
+		values = append(values, v)
+	}
+	if errs != nil {
+		return nil, errs.err()
+	}
+	info.flagCounts = append(info.flagCounts, counts...)
+	info.args = append(info.args, args...)
+	for x, v := range values {
+		if err := registerField(info, set, v, fields[x].tag); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// newFlagValue returns the flagValue for the option declared by f, a field of
+// i, that is to be registered with the set described by info.  raws are the
+// {raw-of} fields of i.  userHelp permits the option to be named help or h.
+// Nothing is registered with the set.
+func newFlagValue(ctx any, info *setInfo, i any, f field, raws map[string]reflect.Value, userHelp bool) (*flagValue, error) {
+	o := f.tag
+	if o.help == "" {
+		o.help = "unspecified"
+	}
+	for _, name := range []string{o.name, o.short} {
+		if err := checkHelpName(o, name, userHelp); err != nil {
+			return nil, err
+		}
+	}
+	value, isList, err := checkedValue(ctx, o, f.value)
+	if err != nil {
+		return nil, err
+	}
+	if def, ok := o.attrs["default"]; ok && f.value.IsZero() {
+		if err := value.Set(def); err != nil {
+			return nil, fmt.Errorf("invalid default %q for flag %s: %v", def, o.name, err)
+		}
+	}
+	if o.hasAttr("optional-value") {
+		value = &optionalValue{Value: value, present: o.attrs["optional-value"]}
+	}
+	if o.hasAttr("preset") {
+		if value, err = newPreset(o, value, info); err != nil {
+			return nil, err
+		}
+	}
+	if o.hasAttr("deprecated") {
+		value = &deprecated{Value: value, info: info, msg: o.deprecation()}
+	}
+	if raw, ok := raws[o.name]; ok {
+		value = &rawValue{Value: value, raw: raw}
+	}
+	if o.hasAttr("together") && o.attrs["together"] == "" {
+		return nil, fmt.Errorf("{together} requires a group name: %s", o.name)
+	}
+	if o.hasAttr("negatable") && !isBoolValue(value) {
+		return nil, fmt.Errorf("{negatable} requires a bool flag: %s", o.name)
+	}
+	return &flagValue{
+		Value:    value,
+		field:    f.name,
+		name:     o.name,
+		short:    o.short,
+		opts:     i,
+		info:     info,
+		required: o.hasAttr("required"),
+		together: o.attrs["together"],
+		count:    o.hasAttr("count"),
+		list:     isList,
+		value:    f.value,
+		def:      copyValue(f.value),
+	}, nil
+}
+
+// checkedValue returns the Value that sets the field fv, declared with the tag
+// o, including the checks declared by the attributes of o, such as {min} and
+// {choices}.  ctx is passed to the Decode method of fv.  isList is reported if
+// the value is an []string whose values are split at commas.
+func checkedValue(ctx any, o *optTag, fv reflect.Value) (value Value, isList bool, err error) {
+	value, err = newValue(o, fv.Addr().Interface())
+	if err != nil {
+		return nil, false, err
+	}
+	if d, ok := value.(*decoderValue); ok {
+		d.ctx = ctx
+	}
+	_, isList = value.(*list)
+	if isList {
+		value = &splitValue{Value: value}
+	}
+	if o.hasAttr("min") || o.hasAttr("max") {
+		if value, err = newBounded(o, value, fv); err != nil {
+			return nil, false, err
+		}
+	}
+	if o.choices() != nil {
+		if value, err = newChoiceValue(o, value, fv); err != nil {
+			return nil, false, err
+		}
+	}
+	if o.hasAttr("sorted") || o.hasAttr("dedup") {
+		if value, err = newListFilter(o, fv.Addr().Interface(), value); err != nil {
+			return nil, false, err
+		}
+	}
+	if o.hasAttr("validate") {
+		if value, err = newValidated(o, value); err != nil {
+			return nil, false, err
+		}
+	}
+	if o.hasAttr("validate-any") {
+		if value, err = newValidatedAny(o, value); err != nil {
+			return nil, false, err
+		}
+	}
+	return value, isList, nil
+}
+
+// registerField registers fv, the flagValue for the option declared by the
+// tag o, with set.
+func registerField(info *setInfo, set FlagSet, fv *flagValue, o *optTag) error {
+	fv.setEnv(o)
+	if err := defineFlag(set, fv, o.name, o.help); err != nil {
+		return err
+	}
+	if o.short != "" {
+		if err := defineFlag(set, fv, o.short, o.help); err != nil {
 			return err
 		}
-		if o == nil {
-			o = &optTag{name: strings.ToLower(field.Name)}
-		}
-		if o.help == "" {
-			o.help = "unspecified"
-		}
-		opt := fv.Addr().Interface()
-		switch t := opt.(type) {
-		case Value:
-			setvar(set, t, o.name, o.help)
-		case *[]string:
-			setvar(set, (*list)(t), o.name, o.help)
-		case *time.Duration:
-			set.DurationVar(t, o.name, *t, o.help)
-		case *string:
-			set.StringVar(t, o.name, *t, o.help)
-		case *int:
-			set.IntVar(t, o.name, *t, o.help)
-		case *int64:
-			set.Int64Var(t, o.name, *t, o.help)
-		case *uint:
-			set.UintVar(t, o.name, *t, o.help)
-		case *uint64:
-			set.Uint64Var(t, o.name, *t, o.help)
-		case *float64:
-			set.Float64Var(t, o.name, *t, o.help)
-		case *bool:
-			set.BoolVar(t, o.name, *t, o.help)
-		default:
-			return fmt.Errorf("invalid option type: %T", fv.Interface())
+	}
+	info.values = append(info.values, fv)
+	if o.hasAttr("negatable") {
+		if err := setvar(set, &negated{v: fv}, "no-"+o.name, "negates --"+o.name); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// defineFlag defines the flag name with usage in set for the option fv.  As
+// with the typed methods of the standard flag package, an option of a basic
+// type, such as string or int, is defined with the typed method of set, e.g.,
+// StringVar, and the flag is then given fv as its Value if set has a Lookup
+// method.  Otherwise the flag is defined with set's Var method, falling back
+// to the typed method if set has no Var method.
+func defineFlag(set FlagSet, fv *flagValue, name, usage string) error {
+	lookup, ok := set.(interface{ Lookup(string) *flag.Flag })
+	if ok && defineBasic(set, fv.value.Addr().Interface(), name, usage) {
+		if f := lookup.Lookup(name); f != nil {
+			f.Value = fv
+		}
+		return nil
+	}
+	err := setvar(set, fv, name, usage)
+	if err != nil && !ok && defineBasic(set, fv.value.Addr().Interface(), name, usage) {
+		return nil
+	}
+	return err
+}
+
+// defineBasic defines the flag name with usage in set for p, a pointer to a
+// field of a basic type, with the typed method of set for the type.  It
+// reports false, defining nothing, if p is not of a basic type.
+func defineBasic(set FlagSet, p any, name, usage string) bool {
+	switch t := p.(type) {
+	case *time.Duration:
+		set.DurationVar(t, name, *t, usage)
+	case *string:
+		set.StringVar(t, name, *t, usage)
+	case *int:
+		set.IntVar(t, name, *t, usage)
+	case *int64:
+		set.Int64Var(t, name, *t, usage)
+	case *uint:
+		set.UintVar(t, name, *t, usage)
+	case *uint64:
+		set.Uint64Var(t, name, *t, usage)
+	case *float64:
+		set.Float64Var(t, name, *t, usage)
+	case *bool:
+		set.BoolVar(t, name, *t, usage)
+	default:
+		return false
+	}
+	return true
+}
+
 // Lookup returns the value of the field in i for the specified option or nil.
 // Lookup can be used if the structure declaring the options is not available.
 // Lookup returns nil if i is invalid or does not have an option named option.
@@ -398,48 +1150,513 @@ func register(name string, i any, set FlagSet) error {
 //	set.Parse(args)
 //	v := flags.Lookup(i, "verbose").(bool)
 func Lookup(i any, option string) any {
-	v := reflect.ValueOf(i)
-	if v.Kind() != reflect.Ptr {
+	fields, err := fields(i)
+	if err != nil {
 		return nil
 	}
-	v = v.Elem()
-	if v.Kind() != reflect.Struct {
-		return nil
+	if f := findField(fields, option); f != nil {
+		return f.value.Interface()
 	}
-	t := v.Type()
+	return nil
+}
 
-	n := t.NumField()
-	for i := 0; i < n; i++ {
-		field := t.Field(i)
-		fv := v.Field(i)
-		tag := field.Tag.Get("flag")
-		if tag == "-" || !fv.CanSet() {
-			continue
-		}
-		o, err := parseTag(tag)
-		if err != nil {
+// Set sets the option named name, as with Lookup, declared by i to value.  The
+// value is validated as declared by the attributes of the option, such as
+// {choices} and {min}.  An error is returned if i does not declare the option
+// or the value is invalid.
+func Set(i any, name, value string) error {
+	fields, err := fields(i)
+	if err != nil {
+		return err
+	}
+	f := findField(fields, name)
+	if f == nil {
+		return fmt.Errorf("unknown flag %s", name)
+	}
+	v, _, err := checkedValue(nil, f.tag, f.value)
+	if err != nil {
+		return err
+	}
+	if err := v.Set(value); err != nil {
+		return &FieldError{Field: f.name, Flag: f.tag.name, Value: value, Err: err}
+	}
+	return nil
+}
+
+// A field is an option declared by a field of an options structure.
+type field struct {
+	name  string        // the name of the field
+	tag   *optTag       // the field's tag, never nil
+	value reflect.Value // the field's value
+}
+
+// fields returns the fields in i that declare options.  An error is returned if
+// i is not a pointer to a struct or has an invalid flag tag.
+func fields(i any) ([]field, error) {
+	fields, errs, err := allFields(i)
+	if err != nil {
+		return nil, err
+	}
+	if errs != nil {
+		return nil, errs.err()
+	}
+	return fields, nil
+}
+
+// allFields is like fields except the problems with the fields of i are
+// returned as errs along with the fields that do not have problems.  err is
+// only returned if i is not a pointer to a struct.
+func allFields(i any) (fields []field, errs TagErrors, err error) {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr {
+		return nil, nil, fmt.Errorf("%T is not a pointer to a struct", i)
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("%T is not a pointer to a struct", i)
+	}
+	metas, errs := typeFieldErrors(v.Type())
+	fields = make([]field, len(metas))
+	for x, m := range metas {
+		// Each caller gets its own copy of the tag as callers, such
+		// as register, may modify it.
+		tag := m.tag
+		fields[x] = field{name: m.name, tag: &tag, value: v.FieldByIndex(m.index)}
+	}
+	return fields, errs, nil
+}
+
+// rawOf returns the name of the option whose text sf receives if sf is tagged
+// with a {raw-of=FLAG} attribute, otherwise "".  Such a field does not declare
+// an option.
+func rawOf(sf reflect.StructField) string {
+	tag := strings.TrimSpace(sf.Tag.Get("flag"))
+	if !strings.HasPrefix(tag, "{raw-of=") || !strings.HasSuffix(tag, "}") {
+		return ""
+	}
+	return strings.TrimSpace(tag[len("{raw-of=") : len(tag)-1])
+}
+
+// isFlagCount reports whether sf is tagged with only a {flag-count}
+// attribute.  Such a field does not declare an option.
+func isFlagCount(sf reflect.StructField) bool {
+	return strings.TrimSpace(sf.Tag.Get("flag")) == "{flag-count}"
+}
+
+// nonOption reports whether sf has a flag tag that does not declare an
+// option, such as a {raw-of=FLAG} or {flag-count} field.
+func nonOption(sf reflect.StructField) bool {
+	return rawOf(sf) != "" || isFlagCount(sf)
+}
+
+// flagCountFields returns the fields of i, a pointer to a struct, tagged with
+// {flag-count}.
+func flagCountFields(i any) ([]reflect.Value, error) {
+	var counts []reflect.Value
+	err := walkFields(reflect.ValueOf(i).Elem(), "", func(sf reflect.StructField, fv reflect.Value, _ string) error {
+		if !isFlagCount(sf) || !sf.IsExported() {
 			return nil
 		}
-		if o == nil {
-			o = &optTag{name: strings.ToLower(field.Name)}
+		if sf.Type.Kind() != reflect.Int {
+			return fmt.Errorf("{flag-count} requires an int, not %v", sf.Type)
+		}
+		counts = append(counts, fv)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// rawFields returns the fields of i, a pointer to a struct, tagged with a
+// {raw-of=FLAG} attribute, keyed by FLAG.  Within a flag group FLAG names an
+// option of the group, e.g., {raw-of=cert} in the group tls is keyed by
+// tls.cert.
+func rawFields(i any) (map[string]reflect.Value, error) {
+	var raws map[string]reflect.Value
+	err := walkFields(reflect.ValueOf(i).Elem(), "", func(sf reflect.StructField, fv reflect.Value, prefix string) error {
+		name := rawOf(sf)
+		if name == "" || !sf.IsExported() {
+			return nil
+		}
+		if sf.Type.Kind() != reflect.String {
+			return fmt.Errorf("{raw-of} requires a string, not %v", sf.Type)
+		}
+		name = prefix + name
+		if _, ok := raws[name]; ok {
+			return fmt.Errorf("multiple fields are the raw text of flag %s", name)
 		}
-		if option == o.name {
-			return fv.Interface()
+		if raws == nil {
+			raws = map[string]reflect.Value{}
+		}
+		raws[name] = fv
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return raws, nil
+}
+
+// A fieldMeta is the information about a field that declares an option that
+// only depends on the type of the structure containing the field.
+type fieldMeta struct {
+	index []int  // index of the field in the structure, see FieldByIndex
+	name  string // the name of the field, e.g., "TLS.Cert"
+	tag   optTag // the field's parsed tag
+}
+
+// A typeMeta is the cached result of parseFields.
+type typeMeta struct {
+	fields []fieldMeta
+	errs   TagErrors
+}
+
+// fieldCache maps a reflect.Type of a structure to its *typeMeta.
+var fieldCache sync.Map
+
+// typeFields returns the fields of the structure type t that declare options.
+// The results are cached so the tags of a type are only parsed once.
+func typeFields(t reflect.Type) ([]fieldMeta, error) {
+	fields, errs := typeFieldErrors(t)
+	if errs != nil {
+		return nil, errs.err()
+	}
+	return fields, nil
+}
+
+// typeFieldErrors is like typeFields but returns each of the problems with the
+// fields of t.
+func typeFieldErrors(t reflect.Type) ([]fieldMeta, TagErrors) {
+	if m, ok := fieldCache.Load(t); ok {
+		tm := m.(*typeMeta)
+		return tm.fields, tm.errs
+	}
+	fields, errs := parseFields(t)
+	fieldCache.Store(t, &typeMeta{fields: fields, errs: errs})
+	return fields, errs
+}
+
+// parseFields returns the fields of the structure type t that declare options.
+// All the problems with the fields are returned, not just the first, along with
+// the fields that do not have problems.
+func parseFields(t reflect.Type) ([]fieldMeta, TagErrors) {
+	var fields []fieldMeta
+	var errs TagErrors
+	n := t.NumField()
+	for i := 0; i < n; i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("flag")
+		if isEmbedded(sf) {
+			efields, eerrs := typeFieldErrors(sf.Type)
+			errs = append(errs, eerrs.within(sf.Name)...)
+			for _, m := range efields {
+				m.index = append([]int{i}, m.index...)
+				m.name = sf.Name + "." + m.name
+				fields = append(fields, m)
+			}
+			continue
+		}
+		if tag == "-" || !sf.IsExported() || isArg(sf) || nonOption(sf) {
+			continue
+		}
+		if group := groupOf(sf); group != "" {
+			gfields, gerrs := typeFieldErrors(sf.Type)
+			errs = append(errs, gerrs.within(sf.Name)...)
+			for _, m := range gfields {
+				m.index = append([]int{i}, m.index...)
+				m.name = sf.Name + "." + m.name
+				if m.tag.short != "" {
+					errs = append(errs, &TagError{Field: m.name, Err: fmt.Errorf("flag group %s: flag --%s may not have a short name", group, m.tag.name)})
+					continue
+				}
+				m.tag.name = group + "." + m.tag.name
+				fields = append(fields, m)
+			}
+			continue
+		}
+		o, err := fieldTag(sf)
+		if err != nil {
+			errs = append(errs, &TagError{Field: sf.Name, Err: err})
+			continue
+		}
+		fields = append(fields, fieldMeta{index: []int{i}, name: sf.Name, tag: *o})
+	}
+	names := map[string]string{} // flag names to field names
+	valid := fields[:0]
+	for _, m := range fields {
+		dup := false
+		for _, name := range []string{m.tag.name, m.tag.short} {
+			if name == "" {
+				continue
+			}
+			if field, ok := names[name]; ok {
+				errs = append(errs, &TagError{Field: m.name, Err: fmt.Errorf("duplicate flag name %q on fields %s and %s", name, field, m.name)})
+				dup = true
+				continue
+			}
+			names[name] = m.name
+		}
+		if !dup {
+			valid = append(valid, m)
+		}
+	}
+	return valid, errs
+}
+
+// A TagError is a problem with the option declared by a field of an options
+// structure, such as an invalid flag tag or an unsupported type.
+type TagError struct {
+	Field string // Name of the field in the options structure
+	Err   error  // The problem with the field
+}
+
+func (e *TagError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *TagError) Unwrap() error {
+	return e.Err
+}
+
+// TagErrors is returned when an options structure has more than one problem.
+// The problems with the flag tags of the structure are listed first, in the
+// order of its fields, followed by duplicate flag names and then the problems
+// with the types and attributes of its fields.
+type TagErrors []*TagError
+
+func (e TagErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d problems with options:", len(e))
+	for _, err := range e {
+		fmt.Fprintf(&b, "\n\t%v", err)
+	}
+	return b.String()
+}
+
+// err returns the error described by e: nil if e is empty, the error of its
+// only problem, or e itself.
+func (e TagErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0].Err
+	default:
+		return e
+	}
+}
+
+// within returns e with the field names prefixed by field, the name of the
+// structure containing them.
+func (e TagErrors) within(field string) TagErrors {
+	errs := make(TagErrors, len(e))
+	for x, err := range e {
+		errs[x] = &TagError{Field: field + "." + err.Field, Err: err.Err}
+	}
+	return errs
+}
+
+// isEmbedded reports whether sf is an embedded structure without a flag tag.
+// The options declared by the fields of such a structure are declared by the
+// structure embedding it, as if they were its own fields.
+func isEmbedded(sf reflect.StructField) bool {
+	_, tagged := sf.Tag.Lookup("flag")
+	return sf.Anonymous && !tagged && sf.Type.Kind() == reflect.Struct
+}
+
+// walkFields calls fn with each field of the structure v, and its value, in
+// order.  The fields of embedded structures and flag groups are walked rather
+// than passed to fn, as parseFields does.  prefix is the prefix of the names
+// of the options in the group containing the field, e.g., "tls.", or "".
+// Walking stops at the first error returned by fn.
+func walkFields(v reflect.Value, prefix string, fn func(sf reflect.StructField, fv reflect.Value, prefix string) error) error {
+	t := v.Type()
+	for x := 0; x < t.NumField(); x++ {
+		sf := t.Field(x)
+		var err error
+		switch {
+		case isEmbedded(sf):
+			err = walkFields(v.Field(x), prefix, fn)
+		case sf.IsExported() && groupOf(sf) != "":
+			err = walkFields(v.Field(x), prefix+groupOf(sf)+".", fn)
+		default:
+			err = fn(sf, v.Field(x), prefix)
+		}
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// groupOf returns the name of the group declared by sf, or "".  A group is a
+// structure whose flag tag is just the name of the group, e.g., `flag:"tls"`.
+// The options declared by the fields of the structure are named after the
+// group, e.g., --tls.cert.
+func groupOf(sf reflect.StructField) string {
+	tag := strings.TrimSpace(sf.Tag.Get("flag"))
+	if sf.Type.Kind() != reflect.Struct || tag == "" || tag[0] == '-' || strings.ContainsAny(tag, " \t{}=") {
+		return ""
+	}
+	return tag
+}
+
+// fieldTag returns the parsed flag tag of sf.  The option is named after the
+// field if the tag is empty.  An env tag, e.g., `env:"PORT"`, is the same as an
+// {env=PORT} attribute in the flag tag.
+func fieldTag(sf reflect.StructField) (*optTag, error) {
+	tag := sf.Tag.Get("flag")
+	o, err := parseTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		o = &optTag{name: strings.ToLower(sf.Name)}
+	}
+	if env := sf.Tag.Get("env"); env != "" {
+		if o.hasAttr("env") && o.attrs["env"] != env {
+			return nil, fmt.Errorf("flag tag {env=%s} conflicts with env tag %q: %q", o.attrs["env"], env, tag)
+		}
+		if o.attrs == nil {
+			o.attrs = map[string]string{}
+		}
+		o.attrs["env"] = env
+	}
+	return o, nil
+}
+
 // An optTag contains all the information extracted from a flag tag.
 type optTag struct {
 	name  string
+	short string // the short name of an option that also has a long name
 	param string
 	help  string
+	attrs map[string]string
+}
+
+// knownAttrs is the set of attribute names that may appear in a flag tag.
+var knownAttrs = map[string]bool{
+	"any-port":         true,
+	"choices":          true,
+	"clock":            true,
+	"count":            true,
+	"dedup":            true,
+	"default":          true,
+	"deprecated":       true,
+	"env":              true,
+	"fetch":            true,
+	"flags":            true,
+	"fromdir":          true,
+	"glob":             true,
+	"glob-allow-empty": true,
+	"help-file":        true,
+	"help-flag":        true,
+	"hidden":           true,
+	"jsonl":            true,
+	"keep-last":        true,
+	"kv-struct":        true,
+	"max":              true,
+	"min":              true,
+	"multiline":        true,
+	"negatable":        true,
+	"oneof":            true,
+	"optional-value":   true,
+	"pem":              true,
+	"preset":           true,
+	"ranges":           true,
+	"required":         true,
+	"ring":             true,
+	"secret":           true,
+	"section":          true,
+	"sorted":           true,
+	"struct":           true,
+	"sum":              true,
+	"together":         true,
+	"validate":         true,
+	"validate-any":     true,
+}
+
+// parseAttrs parses the attribute clause at the start of s, adding the
+// attributes to o, and returns the remainder of s.  A clause is a list of
+// white space separated attributes enclosed in braces, e.g., "{name}" or
+// "{name=value other}".
+func (o *optTag) parseAttrs(s string) (string, error) {
+	x := strings.Index(s, "}")
+	if x < 0 {
+		return "", fmt.Errorf("has unterminated attribute")
+	}
+	for _, attr := range strings.Fields(s[1:x]) {
+		name, value, _ := strings.Cut(attr, "=")
+		switch {
+		case !knownAttrs[name]:
+			return "", fmt.Errorf("has unknown attribute %q", name)
+		case o.hasAttr(name):
+			return "", fmt.Errorf("has duplicate attribute %q", name)
+		}
+		if o.attrs == nil {
+			o.attrs = map[string]string{}
+		}
+		o.attrs[name] = value
+	}
+	return strings.TrimSpace(s[x+1:]), nil
+}
+
+// helpFS is the file system set by SetHelpFS.
+var helpFS fs.FS
+
+// SetHelpFS sets the file system that the {help-file=PATH} attribute reads the
+// help text of options from.  fsys is typically an embed.FS:
+//
+//	//go:embed help
+//	var helpFiles embed.FS
+//
+//	func init() {
+//		flags.SetHelpFS(helpFiles)
+//	}
+//
+// SetHelpFS must be called before the options are registered.
+func SetHelpFS(fsys fs.FS) {
+	helpFS = fsys
+	// The help text of cached tags may have come from the previous file
+	// system.
+	fieldCache.Range(func(key, _ any) bool {
+		fieldCache.Delete(key)
+		return true
+	})
+}
+
+// readHelp sets the help text of o to the contents of the file named by its
+// {help-file} attribute.  White space in the file, including newlines, is
+// collapsed to single spaces.
+func (o *optTag) readHelp() error {
+	if o.help != "" {
+		return fmt.Errorf("has both help text and {help-file}")
+	}
+	if helpFS == nil {
+		return fmt.Errorf("has {help-file} but SetHelpFS has not been called")
+	}
+	data, err := fs.ReadFile(helpFS, o.attrs["help-file"])
+	if err != nil {
+		return fmt.Errorf("help file: %v", err)
+	}
+	o.help = strings.Join(strings.Fields(string(data)), " ")
+	return nil
+}
+
+// hasAttr reports whether o has the attribute name.
+func (o *optTag) hasAttr(name string) bool {
+	_, ok := o.attrs[name]
+	return ok
 }
 
 func (o *optTag) String() string {
 	parts := make([]string, 0, 6)
 	parts = append(parts, "{")
+	if o.short != "" {
+		parts = append(parts, "-"+o.short)
+	}
 	switch len(o.name) {
 	case 0:
 	case 1:
@@ -450,6 +1667,18 @@ func (o *optTag) String() string {
 	if o.param != "" {
 		parts = append(parts, "="+o.param)
 	}
+	names := make([]string, 0, len(o.attrs))
+	for name := range o.attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value := o.attrs[name]; value != "" {
+			parts = append(parts, "{"+name+"="+value+"}")
+		} else {
+			parts = append(parts, "{"+name+"}")
+		}
+	}
 	if o.help != "" {
 		parts = append(parts, fmt.Sprintf("%q", o.help))
 	}
@@ -468,6 +1697,13 @@ func parseTag(tag string) (*optTag, error) {
 	var o optTag
 	var arg, param string
 	for {
+		if o.name != "" && strings.HasPrefix(next, "{") {
+			var err error
+			if next, err = o.parseAttrs(next); err != nil {
+				return nil, fmt.Errorf("flag tag %v: %q", err, tag)
+			}
+			continue
+		}
 		arg, param, next = nextOption(next)
 		if arg == "" || arg == "-" || arg == "--" {
 			if param != "" {
@@ -481,6 +1717,11 @@ func parseTag(tag string) (*optTag, error) {
 				return nil, nil
 			}
 			o.help = next
+			if o.hasAttr("help-file") {
+				if err := o.readHelp(); err != nil {
+					return nil, fmt.Errorf("flag tag %v: %q", err, tag)
+				}
+			}
 			return &o, nil
 		}
 		if param != "" {
@@ -489,11 +1730,20 @@ func parseTag(tag string) (*optTag, error) {
 			}
 			o.param = param
 		}
-		if o.name != "" {
+		// Strip off the leading -- or -.
+		name := strings.TrimPrefix(arg[1:], "-")
+		switch {
+		case o.name == "":
+			o.name = name
+		case o.short != "":
+			return nil, fmt.Errorf("flag tag has too many names: %q", tag)
+		case len(o.name) == 1 && len(name) > 1:
+			o.short, o.name = o.name, name
+		case len(o.name) > 1 && len(name) == 1:
+			o.short = name
+		default:
 			return nil, fmt.Errorf("flag tag has too many names: %q", tag)
 		}
-		// Strip off the leading -- or -.
-		o.name = strings.TrimPrefix(arg[1:], "-")
 	}
 }
 
@@ -578,40 +1828,440 @@ func setvar(fs any, value Value, name, usage string) error {
 //	 -v            be verbose
 //
 // If cmd is the empty string the initial line will not be printed.
+//
+// If any of the options declare an environment variable, the environment
+// variables are listed following the options, as described by
+// HelpEnvironment.
+//
+// If version information has been provided by SetVersion, the usage line is
+// preceded by a header line such as:
+//
+//	xyzzy version 1.2.0 (commit 9f8e7d6, built 2023-04-01)
 func Help(w io.Writer, cmd, parameters string, i any) {
+	help(w, cmd, parameters, i, helpLines)
+}
+
+// HelpFull is like Help except the output is never limited by SetHelpLines.
+func HelpFull(w io.Writer, cmd, parameters string, i any) {
+	help(w, cmd, parameters, i, 0)
+}
+
+// helpLines is the number of lines set by SetHelpLines.
+var helpLines int
+
+// SetHelpLines limits the output of Help to n lines.  When the options do not
+// fit, Help stops before the first option that does not fit and writes the
+// line
+//
+//	(run --help-full for all options)
+//
+// after the options that fit.  The environment variables are not displayed.
+// HelpFull may be used to display all of the options.  Passing 0 removes the
+// limit, which is the default.
+func SetHelpLines(n int) {
+	helpLines = n
+}
+
+// requiredFirst is set by SetHelpRequiredFirst.
+var requiredFirst bool
+
+// SetHelpRequiredFirst sets whether Help and UsageLine list the options with
+// the {required} attribute before the other options.  When set, each group of
+// options is listed in the order the options are declared rather than sorted
+// by name.  By default the options are sorted by name.
+func SetHelpRequiredFirst(on bool) {
+	requiredFirst = on
+}
+
+// help implements Help, limiting the output to max lines if max is positive.
+func help(w io.Writer, cmd, parameters string, i any, max int) {
 	usage, ml := getInfo(i, 20)
+	if useASCII() {
+		w = asciiWriter{w}
+	}
+	lines := 0
 	if cmd != "" {
-		fmt.Fprintf(w, "Usage: %s\n", getUsageLine(cmd, parameters, usage))
+		if header := versionHeader(cmd); header != "" {
+			fmt.Fprintln(w, header)
+			lines++
+		}
+		fmt.Fprintf(w, "%s %s\n", message("usage"), getUsageLine(cmd, parameters, usage, argSynopsis(i)))
+		lines++
+	}
+	if max > 0 {
+		// Always leave room for at least the first option.
+		max -= lines
+		if max < 1 {
+			max = 1
+		}
+	}
+	write := writeFlags
+	if hasSections(usage) {
+		write = writeSections
+	}
+	if write(w, usage, ml, max) {
+		fmt.Fprintln(w, message("more"))
+		return
 	}
+	if hasEnvironment(usage) {
+		fmt.Fprintln(w)
+		writeEnvironment(w, usage)
+	}
+}
+
+// HelpGrep writes the help for only the options in i whose name or help text
+// contains pattern, ignoring case, to w.  The options are displayed as they
+// are by Help.  HelpGrep is useful for finding options in large sets of
+// options, e.g., by a --help-grep flag.
+func HelpGrep(w io.Writer, i any, pattern string) {
+	usage, ml := getInfo(i, 20)
+	if useASCII() {
+		w = asciiWriter{w}
+	}
+	pattern = strings.ToLower(pattern)
+	var matched []flagInfo
+	for _, i := range usage {
+		if strings.Contains(strings.ToLower(i.name), pattern) || strings.Contains(strings.ToLower(i.help), pattern) {
+			matched = append(matched, i)
+		}
+	}
+	writeFlags(w, matched, ml, 0)
+}
+
+// writeFlags writes the options in usage to w with their help text starting in
+// column ml+5.  If max is positive, writeFlags stops before the first option
+// that would cause more than max lines to be written and returns true.
+func writeFlags(w io.Writer, usage []flagInfo, ml, max int) bool {
 	w = indent.NewWriter(w, "  ")
+	// The help text starts in column ml+5: two for the indent, two for the
+	// prefix, and one for the separating space.
+	width := HelpWidth() - (ml + 5)
+	n := 0
 	for _, i := range usage {
-		flag := i.prefix + i.flag
-		if i.help == "" && i.def == "" {
-			fmt.Fprintf(w, "%s\n", flag)
-		} else if len(flag) > ml {
-			fmt.Fprintf(w, "%s\n  %*s %s%s\n", flag, ml, "", i.help, i.def)
-		} else {
-			fmt.Fprintf(w, "%s%*s %s%s\n", flag, ml-len(i.flag), "", i.help, i.def)
+		lines := flagLines(i, ml, width)
+		if n += len(lines); max > 0 && n > max {
+			return true
+		}
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
 		}
 	}
+	return false
+}
+
+// hasSections reports whether any of the options in usage have a {section}.
+func hasSections(usage []flagInfo) bool {
+	for _, i := range usage {
+		if i.section != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSections is like writeFlags but writes the options in usage in
+// sections, in the order they are declared.  Each section is headed by its
+// name.  The options without a {section} are written first.
+func writeSections(w io.Writer, usage []flagInfo, ml, max int) bool {
+	sorted := make([]flagInfo, len(usage))
+	copy(sorted, usage)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].order < sorted[j].order })
+	var names []string
+	sections := map[string][]flagInfo{}
+	for _, i := range sorted {
+		if _, ok := sections[i.section]; !ok && i.section != "" {
+			names = append(names, i.section)
+		}
+		sections[i.section] = append(sections[i.section], i)
+	}
+	if sections[""] != nil {
+		names = append([]string{""}, names...)
+	}
+	width := HelpWidth() - (ml + 5)
+	n := 0
+	for _, name := range names {
+		header := name + ":"
+		if name == "" {
+			header = message("section")
+		}
+		// The header is written with the first option of the section.
+		lines := []string{"", header}
+		for _, i := range sections[name] {
+			for _, line := range flagLines(i, ml, width) {
+				lines = append(lines, "  "+line)
+			}
+			if n += len(lines); max > 0 && n > max {
+				return true
+			}
+			for _, line := range lines {
+				fmt.Fprintln(w, strings.TrimRight(line, " "))
+			}
+			lines = nil
+		}
+	}
+	return false
+}
+
+// flagLines returns the lines of help for the option i, wrapping its help text
+// to width.
+func flagLines(i flagInfo, ml, width int) []string {
+	flag := i.left()
+	if i.help == "" && i.def == "" {
+		return []string{flag}
+	}
+	help := wrap(i.help+i.def, width)
+	var lines []string
+	if len(flag) > ml {
+		lines = append(lines, flag, fmt.Sprintf("  %*s %s", ml, "", help[0]))
+	} else {
+		lines = append(lines, fmt.Sprintf("%s%*s %s", flag, ml-len(flag)+2, "", help[0]))
+	}
+	for _, line := range help[1:] {
+		lines = append(lines, fmt.Sprintf("  %*s %s", ml, "", line))
+	}
+	return lines
+}
+
+// ColumnWidth returns the width of the left column of the options written by
+// Help for i, that is, the column at which the help text of each option
+// starts.  It is useful for aligning additional output with that of Help:
+//
+//	flags.Help(w, cmd, "", opts)
+//	fmt.Fprintf(w, "%-*s%s\n", flags.ColumnWidth(opts), "  FILE", "the input file")
+func ColumnWidth(i any) int {
+	_, ml := getInfo(i, 20)
+	// Two for the indent, two for the prefix, and one for the separating
+	// space.  See Help.
+	return ml + 5
+}
+
+// HelpEnvironment writes the environment variables consulted by the options
+// in i, as declared by their {env=NAME} attributes, to w.  Help includes this
+// section, preceded by a blank line, when at least one option declares an
+// environment variable.  As an
+// example:
+//
+//	Environment:
+//	  APP_HOST    --host
+//	  APP_PORT    --port
+//
+// Nothing is written if no options declare an environment variable.
+func HelpEnvironment(w io.Writer, i any) {
+	usage, _ := getInfo(i, 0)
+	if useASCII() {
+		w = asciiWriter{w}
+	}
+	writeEnvironment(w, usage)
+}
+
+// hasEnvironment reports whether any flag in usage declares an environment
+// variable.
+func hasEnvironment(usage []flagInfo) bool {
+	for _, i := range usage {
+		if i.env != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEnvironment writes the environment section for usage to w.
+func writeEnvironment(w io.Writer, usage []flagInfo) {
+	if !hasEnvironment(usage) {
+		return
+	}
+	ml := 0
+	for _, i := range usage {
+		if len(i.env) > ml {
+			ml = len(i.env)
+		}
+	}
+	fmt.Fprintf(w, "%s\n", message("environment"))
+	for _, i := range usage {
+		if i.env != "" {
+			fmt.Fprintf(w, "  %-*s  %s%s\n", ml+2, i.env, strings.TrimSpace(i.prefix), i.name)
+		}
+	}
+}
+
+// versionInfo is the version information set by SetVersion.
+var versionInfo struct {
+	version string
+	commit  string
+	date    string
+}
+
+// SetVersion sets the version information displayed in the header printed by
+// Help.  commit and date are optional and may be empty.  The header is not
+// printed if version is the empty string.
+func SetVersion(version, commit, date string) {
+	versionInfo.version = version
+	versionInfo.commit = commit
+	versionInfo.date = date
+}
+
+// versionHeader returns the version header line for cmd or "" if no version
+// has been set.
+func versionHeader(cmd string) string {
+	if versionInfo.version == "" {
+		return ""
+	}
+	var extra []string
+	if versionInfo.commit != "" {
+		extra = append(extra, message("commit")+" "+versionInfo.commit)
+	}
+	if versionInfo.date != "" {
+		extra = append(extra, message("built")+" "+versionInfo.date)
+	}
+	header := cmd + " " + message("version") + " " + versionInfo.version
+	if len(extra) > 0 {
+		header += " (" + strings.Join(extra, ", ") + ")"
+	}
+	return header
+}
+
+// minHelpWidth is the narrowest column of help text Help will wrap to.  Help
+// text is not wrapped if less room than this is available.
+const minHelpWidth = 20
+
+// helpWidth is the width set by SetHelpWidth.  0 means auto-detect.
+var helpWidth int
+
+// SetHelpWidth sets the width of the output generated by Help to n columns.
+// Help text that does not fit in n columns is wrapped.  Passing 0 restores
+// the default of auto-detecting the width from the COLUMNS environment
+// variable.  Help text is not wrapped unless a width is set or detected.
+//
+// SetHelpWidth is useful when the output is not a terminal, such as CI logs,
+// where a consistent width is desired.
+func SetHelpWidth(n int) {
+	helpWidth = n
+}
+
+// HelpWidth returns the width Help wraps its output to.  If no width has been
+// set by SetHelpWidth, the width is taken from the COLUMNS environment
+// variable.  HelpWidth returns 0, meaning Help does not wrap its output, if
+// neither is set.
+func HelpWidth() int {
+	if helpWidth > 0 {
+		return helpWidth
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// wrap splits s into lines of no more than width bytes, breaking at white
+// space.  Words longer than width are not broken.  s is returned as a single
+// line if width is less than minHelpWidth.
+func wrap(s string, width int) []string {
+	if width < minHelpWidth || len(s) <= width {
+		return []string{s}
+	}
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(s) {
+		switch {
+		case line == "":
+			line = word
+		case len(line)+1+len(word) > width:
+			lines = append(lines, line)
+			line = word
+		default:
+			line += " " + word
+		}
+	}
+	return append(lines, line)
+}
+
+// synopsisOpen and synopsisClose enclose the optional elements of a usage line.
+var synopsisOpen, synopsisClose = "[", "]"
+
+// SetSynopsisBrackets sets the delimiters that enclose optional flags and
+// arguments in the usage line generated by UsageLine and Help.  The defaults
+// are "[" and "]".  For example, after
+//
+//	flags.SetSynopsisBrackets("<", ">")
+//
+// the usage line "cmd [-v] SRC [DST]" is displayed as "cmd <-v> SRC <DST>".
+// Passing two empty strings restores the defaults.
+func SetSynopsisBrackets(optOpen, optClose string) {
+	if optOpen == "" && optClose == "" {
+		optOpen, optClose = "[", "]"
+	}
+	synopsisOpen, synopsisClose = optOpen, optClose
 }
 
 // UsageLine returns the usage line for the flag set specified by i.
 // A usage line looks like:
 //
-//	cmd [--first=VALUE] ... [--last] parameters
+//	cmd [--first=VALUE] ... [--last] ARGS parameters
 //
-// cmd and parameters can be empty strings.
+// where ARGS are the positional arguments declared by i, if any, e.g.,
+// "SRC [DST] [EXTRA...]".  cmd and parameters can be empty strings.
 func UsageLine(cmd, parameters string, i any) string {
 	usage, _ := getInfo(i, 0)
-	return getUsageLine(cmd, parameters, usage)
+	return getUsageLine(cmd, parameters, usage, argSynopsis(i))
 }
 
-func getUsageLine(cmd, parameters string, usage []flagInfo) string {
+func getUsageLine(cmd, parameters string, usage []flagInfo, args string) string {
 	var b strings.Builder
 	fmt.Fprintf(&b, "%s", cmd)
 	for _, i := range usage {
-		fmt.Fprintf(&b, " [%s%s]", strings.TrimSpace(i.prefix), i.flag)
+		if i.deprecated {
+			continue
+		}
+		fmt.Fprintf(&b, " %s%s%s", synopsisOpen, i.usage(), synopsisClose)
+	}
+	if args != "" {
+		fmt.Fprintf(&b, " %s", args)
+	}
+	if parameters != "" {
+		fmt.Fprintf(&b, " %s", parameters)
+	}
+	return strings.TrimPrefix(b.String(), " ")
+}
+
+// compactThreshold is set by SetCompactUsageThreshold.
+var compactThreshold = 5
+
+// SetCompactUsageThreshold sets the number of options CompactUsageLine lists
+// before it collapses them into "[options]".  The default is 5.
+func SetCompactUsageThreshold(n int) {
+	compactThreshold = n
+}
+
+// CompactUsageLine is like UsageLine except that when there are more options
+// than set by SetCompactUsageThreshold the options that are not required are
+// replaced by "[options]", e.g., "cmd --name=NAME [options] FILE".
+func CompactUsageLine(cmd, parameters string, i any) string {
+	usage, _ := getInfo(i, 0)
+	args := argSynopsis(i)
+	var shown []flagInfo
+	for _, i := range usage {
+		if !i.deprecated {
+			shown = append(shown, i)
+		}
+	}
+	if len(shown) <= compactThreshold {
+		return getUsageLine(cmd, parameters, shown, args)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s", cmd)
+	optional := false
+	for _, i := range shown {
+		if i.required {
+			fmt.Fprintf(&b, " %s", i.usage())
+		} else {
+			optional = true
+		}
+	}
+	if optional {
+		fmt.Fprintf(&b, " %s%s%s", synopsisOpen, message("options"), synopsisClose)
+	}
+	if args != "" {
+		fmt.Fprintf(&b, " %s", args)
 	}
 	if parameters != "" {
 		fmt.Fprintf(&b, " %s", parameters)
@@ -621,65 +2271,111 @@ func getUsageLine(cmd, parameters string, usage []flagInfo) string {
 
 type flagInfo struct {
 	prefix string
+	name   string
+	short  string
 	flag   string
 	param  string
 	help   string
 	def    string
+	env    string
+
+	required   bool
+	deprecated bool // omitted from the usage line
+
+	section string // the option's {section}, if any
+	order   int    // the position the option was declared in
 }
 
-// getInfo returns a sorted list of flagInfo for each flag in i.  It also returns the longest name in i.
-func getInfo(i any, max int) ([]flagInfo, int) {
-	v := reflect.ValueOf(i)
-	if v.Kind() != reflect.Ptr {
-		return nil, 0
+// usage returns the flag as shown in the usage line, e.g., "--name=NAME" or
+// "-n|--name=NAME".
+func (i flagInfo) usage() string {
+	flag := strings.TrimSpace(i.prefix) + i.flag
+	if i.short != "" {
+		flag = "-" + i.short + "|" + flag
 	}
-	v = v.Elem()
-	if v.Kind() != reflect.Struct {
-		return nil, 0
+	return flag
+}
+
+// left returns the flag as shown in the left column of Help, e.g., "--name=NAME"
+// or "-n, --name=NAME".
+func (i flagInfo) left() string {
+	if i.short != "" {
+		return "-" + i.short + ", --" + i.flag
 	}
-	t := v.Type()
+	return i.prefix + i.flag
+}
 
-	n := t.NumField()
+// getInfo returns a sorted list of flagInfo for each flag in i, see
+// SetHelpRequiredFirst.  It also returns the longest name in i.
+func getInfo(i any, max int) ([]flagInfo, int) {
+	fields, err := fields(i)
+	if err != nil {
+		return nil, 0
+	}
 	var usage []flagInfo
 	ml := 0
-	for i := 0; i < n; i++ {
-		field := t.Field(i)
-		fv := v.Field(i)
-		tag := field.Tag.Get("flag")
-		if tag == "-" || !fv.CanSet() {
+	for x, f := range fields {
+		o, fv := f.tag, f.value
+		if o.hasAttr("hidden") {
 			continue
 		}
-		o, err := parseTag(tag)
-		if err != nil {
-			continue
-		}
-		if o == nil {
-			o = &optTag{name: strings.ToLower(field.Name)}
-		}
 		i := flagInfo{
-			prefix: "--",
-			flag:   o.name,
-			help:   o.help,
+			order:   x,
+			section: o.attrs["section"],
+			prefix:  "--",
+			name:    o.name,
+			flag:    o.name,
+			help:    o.help,
+			env:     o.attrs["env"],
 		}
 		if len(o.name) == 1 {
 			i.prefix = " -"
 		}
-		opt := fv.Addr().Interface()
-		if _, ok := opt.(*bool); !ok {
+		i.short = o.short
+		i.required = o.hasAttr("required")
+		if choices := o.choices(); choices != nil {
+			i.help += " (" + message("oneof") + " " + strings.Join(choices, ", ") + ")"
+		}
+		if o.hasAttr("deprecated") {
+			i.deprecated = true
+			i.help += " (" + message("deprecated") + ")"
+		}
+		value, _ := newValue(o, fv.Addr().Interface())
+		if !isBoolValue(value) {
 			if o.param == "" {
 				o.param = "VALUE"
 			}
-			i.flag += "=" + o.param
+			if o.hasAttr("optional-value") {
+				i.flag += "[=" + o.param + "]"
+			} else {
+				i.flag += "=" + o.param
+			}
 			i.param = o.param
 		}
-		if fv.IsValid() && !fv.IsZero() {
-			i.def = fmt.Sprintf(" [%v]", fv.Interface())
+		switch def, ok := o.attrs["default"]; {
+		case o.hasAttr("secret"):
+			// The value of a secret is never displayed.
+		case fv.IsValid() && !fv.IsZero():
+			// The default format of a struct, such as atomic.Int64,
+			// of a map, of a {kv-struct} list, or of a {flags} bitmask
+			// is not meaningful.
+			if (fv.Kind() == reflect.Struct || fv.Kind() == reflect.Map || o.hasAttr("kv-struct") || o.hasAttr("flags")) && value != nil {
+				i.def = fmt.Sprintf(" [%s]", value)
+			} else {
+				i.def = fmt.Sprintf(" [%v]", fv.Interface())
+			}
+		case ok:
+			i.def = fmt.Sprintf(" [%s]", def)
 		}
-		if n := len(i.flag) + 1 + len(i.prefix); n > ml && n < max {
+		if n := len(i.left()) + 1; n > ml && n < max {
 			ml = n
 		}
 		usage = append(usage, i)
 	}
-	sort.Slice(usage, func(i, j int) bool { return usage[i].flag < usage[j].flag })
+	if requiredFirst {
+		sort.SliceStable(usage, func(i, j int) bool { return usage[i].required && !usage[j].required })
+	} else {
+		sort.Slice(usage, func(i, j int) bool { return usage[i].flag < usage[j].flag })
+	}
 	return usage, ml
 }
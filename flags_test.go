@@ -15,9 +15,12 @@ package flags
 
 import (
 	"bytes"
+	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -82,6 +85,41 @@ func TestSetVar(t *testing.T) {
 	}
 }
 
+// A typedSet is a FlagSet that only has the methods of FlagSet, not Var,
+// Lookup, or VisitAll.
+type typedSet struct {
+	FlagSet
+}
+
+func TestTypedSet(t *testing.T) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(&bytes.Buffer{})
+	opts := &struct {
+		Name    string        `flag:"--name=NAME the name"`
+		Count   int           `flag:"-c --count=N the count"`
+		Timeout time.Duration `flag:"--timeout=DURATION the timeout"`
+		V       bool          `flag:"-v be verbose"`
+	}{Name: "bob"}
+	if err := RegisterSet("", opts, typedSet{fs}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse([]string{"-c", "3", "--timeout=1s", "-v"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Name != "bob" || opts.Count != 3 || opts.Timeout != time.Second || !opts.V {
+		t.Errorf("got %+v", *opts)
+	}
+	if got := fs.Lookup("name").DefValue; got != "bob" {
+		t.Errorf("got default %q, want bob", got)
+	}
+
+	// Other option types require a Var method.
+	err := RegisterSet("", &struct{ Names []string }{}, typedSet{flag.NewFlagSet("", flag.ContinueOnError)})
+	if s := check.Error(err, "missing Var method"); s != "" {
+		t.Error(s)
+	}
+}
+
 func TestLookup(t *testing.T) {
 	opt := &struct {
 		Ignore bool   `flag:"-"`
@@ -160,6 +198,41 @@ func TestValidate(t *testing.T) {
 	}()
 }
 
+func TestValidateError(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts any
+		err  string
+	}{{
+		name: "valid",
+		opts: &struct {
+			Name string `flag:"--name=NAME the name"`
+		}{},
+	}, {
+		name: "not a pointer",
+		opts: struct{}{},
+		err:  "struct {} is not a pointer to a struct",
+	}, {
+		name: "bad tag",
+		opts: &struct {
+			Name string `flag:"the_name"`
+		}{},
+		err: `flag tag missing option name: "the_name"`,
+	}, {
+		name: "bad type",
+		opts: &struct {
+			C chan int `flag:"--c a channel"`
+		}{},
+		err: "invalid option type: chan int",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			if s := check.Error(ValidateError(tt.opts), tt.err); s != "" {
+				t.Error(s)
+			}
+		})
+	}
+}
+
 func TestRegisterSet(t *testing.T) {
 	opts := &struct {
 		Name string `flag:"--the_name"`
@@ -249,6 +322,123 @@ func TestMultiString(t *testing.T) {
 	}
 }
 
+func TestCommaList(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{args: []string{"--list", "item1,item2,item3"}, want: []string{"item1", "item2", "item3"}},
+		{args: []string{"--list", "a,b", "--list", "c"}, want: []string{"a", "b", "c"}},
+		{args: []string{"--list", `a\,b,c`}, want: []string{"a,b", "c"}},
+		{args: []string{"--list", `a\b`}, want: []string{`a\b`}},
+		{args: []string{"--list", "a,", "--list", ""}, want: []string{"a", "", ""}},
+	} {
+		var opts struct {
+			List []string `flag:"--list=ITEM an item"`
+		}
+		if _, err := SubRegisterAndParse(&opts, append([]string{"name"}, tt.args...)); err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(opts.List, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.args, opts.List, tt.want)
+		}
+	}
+}
+
+func TestGetter(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	opts := &struct {
+		Names  []string `flag:"--name=NAME a name"`
+		Sorted []string `flag:"--sorted=NAME {sorted} a sorted name"`
+		Color  string   `flag:"--color=COLOR {choices=red,green} the color"`
+		Level  int      `flag:"--level=N {min=1} the level"`
+		Old    bool     `flag:"--old {deprecated} the old flag"`
+	}{}
+	set := flag.NewFlagSet("", flag.ContinueOnError)
+	if err := RegisterSet("", opts, set); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Parse([]string{"--name=a", "--sorted=b,a", "--color=red", "--level=2", "--old"}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]any{
+		"name":   []string{"a"},
+		"sorted": []string{"a", "b"},
+		"color":  "red",
+		"level":  2,
+		"old":    true,
+	} {
+		g, ok := set.Lookup(name).Value.(flag.Getter)
+		if !ok {
+			t.Errorf("%s: %T is not a flag.Getter", name, set.Lookup(name).Value)
+			continue
+		}
+		if got := g.Get(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %#v, want %#v", name, got, want)
+		}
+	}
+}
+
+func TestMultiFloat(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	var opts struct {
+		Weights []float64 `flag:"--weight a weight"`
+	}
+	_, err := SubRegisterAndParse(&opts, []string{"name", "--weight", "1.5", "--weight", "2.0", "--weight", "-1e-3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{1.5, 2, -0.001}
+	if !reflect.DeepEqual(opts.Weights, want) {
+		t.Errorf("got weights %v, want %v", opts.Weights, want)
+	}
+	if got, ok := Lookup(&opts, "weight").([]float64); !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup got %v (%T), want %v", Lookup(&opts, "weight"), Lookup(&opts, "weight"), want)
+	}
+	if got, want := (*float64List)(&opts.Weights).String(), "1.5 2 -0.001"; got != want {
+		t.Errorf("got string %q, want %q", got, want)
+	}
+	if got, want := UsageLine("name", "", &opts), "name [--weight=VALUE]"; got != want {
+		t.Errorf("got usage %q, want %q", got, want)
+	}
+
+	_, err = SubRegisterAndParse(&opts, []string{"name", "--weight", "heavy"})
+	if s := check.Error(err, `invalid value "heavy" for flag -weight: parse error`); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestMultiInt(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	var opts struct {
+		Ports []int   `flag:"--port=N a port"`
+		Sizes []int64 `flag:"--size=N a size"`
+	}
+	_, err := SubRegisterAndParse(&opts, []string{"name", "--port", "80", "--port", "443", "--size", "1", "--size", "0x10000000000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{80, 443}; !reflect.DeepEqual(opts.Ports, want) {
+		t.Errorf("got ports %v, want %v", opts.Ports, want)
+	}
+	if want := []int64{1, 1 << 40}; !reflect.DeepEqual(opts.Sizes, want) {
+		t.Errorf("got sizes %v, want %v", opts.Sizes, want)
+	}
+
+	_, err = SubRegisterAndParse(&opts, []string{"name", "--port", "80", "--port", "http"})
+	if s := check.Error(err, `invalid value "http" for flag -port: parse error`); s != "" {
+		t.Error(s)
+	}
+	_, err = SubRegisterAndParse(&opts, []string{"name", "--size", "0x10000000000000000"})
+	if s := check.Error(err, "value out of range"); s != "" {
+		t.Error(s)
+	}
+}
+
 func TestSubRegisterAndParse(t *testing.T) {
 	var b bytes.Buffer
 	output = &b
@@ -293,8 +483,8 @@ func TestSubRegisterAndParse(t *testing.T) {
 			t.Errorf("%q got args %#v, want %#v", tt.args, args, tt.out)
 		}
 	}
-	_, err := SubRegisterAndParse(&struct{ N int16 }{}, []string{"c"})
-	if s := check.Error(err, "invalid option type: int16"); s != "" {
+	_, err := SubRegisterAndParse(&struct{ N complex64 }{}, []string{"c"})
+	if s := check.Error(err, "invalid option type: complex64"); s != "" {
 		t.Error(s)
 	}
 	_, err = SubRegisterAndParse(&struct{}{}, []string{"c", "-v"})
@@ -393,6 +583,42 @@ func TestParseTag(t *testing.T) {
 				help:  "- this is help",
 			},
 		},
+		{
+			name: "attributes",
+			in:   "--option=PARAM {ranges} this is help",
+			str:  `{ --option =PARAM {ranges} "this is help" }`,
+			tag: &optTag{
+				name:  "option",
+				param: "PARAM",
+				help:  "this is help",
+				attrs: map[string]string{"ranges": ""},
+			},
+		},
+		{
+			name: "attribute help",
+			in:   "--option {ranges} -- {help}",
+			str:  `{ --option {ranges} "{help}" }`,
+			tag: &optTag{
+				name:  "option",
+				help:  "{help}",
+				attrs: map[string]string{"ranges": ""},
+			},
+		},
+		{
+			name: "unknown attribute",
+			in:   "--option {bogus}",
+			err:  `tag has unknown attribute "bogus"`,
+		},
+		{
+			name: "duplicate attribute",
+			in:   "--option {ranges ranges}",
+			err:  `tag has duplicate attribute "ranges"`,
+		},
+		{
+			name: "unterminated attribute",
+			in:   "--option {ranges help",
+			err:  "tag has unterminated attribute",
+		},
 		{
 			name: "two longs",
 			in:   "--option1 --option2",
@@ -403,6 +629,32 @@ func TestParseTag(t *testing.T) {
 			in:   "-a -b",
 			err:  "tag has too many names",
 		},
+		{
+			name: "short and long",
+			in:   "-v --verbose=LEVEL be verbose",
+			str:  `{ -v --verbose =LEVEL "be verbose" }`,
+			tag: &optTag{
+				name:  "verbose",
+				short: "v",
+				param: "LEVEL",
+				help:  "be verbose",
+			},
+		},
+		{
+			name: "long and short",
+			in:   "--verbose -v be verbose",
+			str:  `{ -v --verbose "be verbose" }`,
+			tag: &optTag{
+				name:  "verbose",
+				short: "v",
+				help:  "be verbose",
+			},
+		},
+		{
+			name: "three names",
+			in:   "-v --verbose -V",
+			err:  "tag has too many names",
+		},
 		{
 			name: "two parms",
 			in:   "--option=PARAM1 -o=PARAM2",
@@ -677,9 +929,9 @@ func TestError(t *testing.T) {
 		panic: "*int is not a pointer to a struct",
 	}, {
 		i: &struct {
-			Int16 int16
+			Complex complex64
 		}{},
-		panic: "invalid option type: int16",
+		panic: "invalid option type: complex64",
 	}} {
 		t.Run(fmt.Sprintf("%v", tt.i), func(t *testing.T) {
 			defer func() {
@@ -749,6 +1001,41 @@ func TestUsageLine(t *testing.T) {
 	}
 }
 
+func TestCompactUsageLine(t *testing.T) {
+	defer SetCompactUsageThreshold(5)
+	type options struct {
+		Alpha   string `flag:"--alpha=LEVEL the alpha level"`
+		Beta    int    `flag:"--beta=N {required} the beta"`
+		Gamma   bool   `flag:"--gamma use gamma"`
+		Delta   bool   `flag:"-d --delta use delta"`
+		Epsilon bool   `flag:"--epsilon {deprecated} use epsilon"`
+		Zeta    string `flag:"-z=Z {required} the zeta"`
+		File    string `arg:"FILE the file"`
+	}
+	for _, tt := range []struct {
+		threshold int
+		want      string
+	}{
+		{5, "cmd [--alpha=LEVEL] [--beta=N] [-d|--delta] [--gamma] [-z=Z] FILE param"},
+		{4, "cmd --beta=N -z=Z [options] FILE param"},
+		{0, "cmd --beta=N -z=Z [options] FILE param"},
+	} {
+		SetCompactUsageThreshold(tt.threshold)
+		if got := CompactUsageLine("cmd", "param", &options{}); got != tt.want {
+			t.Errorf("threshold %d: got %q, want %q", tt.threshold, got, tt.want)
+		}
+	}
+	opts := &struct {
+		Name string
+	}{}
+	if got, want := CompactUsageLine("cmd", "", opts), "cmd [options]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := UsageLine("cmd", "", opts), "cmd [--name=VALUE]"; got != want {
+		t.Errorf("UsageLine got %q, want %q", got, want)
+	}
+}
+
 func TestGetInfo(t *testing.T) {
 	u, i := getInfo(new(string), 10)
 	if u != nil || i != 0 {
@@ -768,12 +1055,1460 @@ func TestExtra(t *testing.T) {
 	var opts = &struct {
 		Name    string `flag:"--name"`
 		Private string `flag:"-"`
-		Int16   int16
+		Complex complex64
 	}{}
 	defer func() {
-		if s := checkPanic(recover(), "invalid option type: int16"); s != "" {
+		if s := checkPanic(recover(), "invalid option type: complex64"); s != "" {
 			t.Error(s)
 		}
 	}()
 	RegisterNew("extra", opts)
 }
+
+func TestHelpWidth(t *testing.T) {
+	defer SetHelpWidth(0)
+	opts := &struct {
+		Name string `flag:"--name=NAME the name of the widget that is to be constructed by the factory"`
+		V    bool   `flag:"-v be verbose"`
+	}{}
+	want := `
+  --name=NAME    the name of the widget
+                 that is to be
+                 constructed by the
+                 factory
+   -v            be verbose
+`[1:]
+	SetHelpWidth(40)
+	if w := HelpWidth(); w != 40 {
+		t.Errorf("HelpWidth got %d, want 40", w)
+	}
+	var out bytes.Buffer
+	Help(&out, "", "", opts)
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if len(line) > 40 {
+			t.Errorf("line longer than 40: %q", line)
+		}
+	}
+
+	t.Setenv("COLUMNS", "100")
+	SetHelpWidth(0)
+	if w := HelpWidth(); w != 100 {
+		t.Errorf("HelpWidth got %d, want 100", w)
+	}
+
+	// By default help text is not wrapped.
+	t.Setenv("COLUMNS", "")
+	if w := HelpWidth(); w != 0 {
+		t.Errorf("HelpWidth got %d, want 0", w)
+	}
+	want = `
+  --name=NAME    the name of the widget that is to be constructed by the factory
+   -v            be verbose
+`[1:]
+	out.Reset()
+	Help(&out, "", "", opts)
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHelpVersion(t *testing.T) {
+	defer SetVersion("", "", "")
+	opts := &struct {
+		V bool `flag:"-v be verbose"`
+	}{}
+	for _, tt := range []struct {
+		version, commit, date string
+		header                string
+	}{{
+		header: "",
+	}, {
+		version: "1.2.0",
+		header:  "xyzzy version 1.2.0\n",
+	}, {
+		version: "1.2.0",
+		commit:  "9f8e7d6",
+		date:    "2023-04-01",
+		header:  "xyzzy version 1.2.0 (commit 9f8e7d6, built 2023-04-01)\n",
+	}} {
+		SetVersion(tt.version, tt.commit, tt.date)
+		want := tt.header + "Usage: xyzzy [-v]\n   -v    be verbose\n"
+		var out bytes.Buffer
+		Help(&out, "xyzzy", "", opts)
+		if got := out.String(); got != want {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestValidateShorts(t *testing.T) {
+	type common struct {
+		Verbose bool `flag:"-v be verbose"`
+		Name    string
+	}
+	type other struct {
+		Version bool `flag:"-v display the version"`
+		N       int
+		Q       bool
+	}
+	type more struct {
+		Value bool `flag:"-v the value"`
+		Q     bool
+	}
+	if errs := ValidateShorts(&common{}, &struct{ N int }{}); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	errs := ValidateShorts(&common{}, &other{}, &more{}, "bad")
+	want := []string{
+		"short flag -v declared by Verbose (argument 1) and Version (argument 2)",
+		"short flag -v declared by Verbose (argument 1) and Value (argument 3)",
+		"short flag -q declared by Q (argument 2) and Q (argument 3)",
+		"string is not a pointer to a struct",
+	}
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRegisterNewT(t *testing.T) {
+	type options struct {
+		Name    string `flag:"--name=NAME the name"`
+		Count   int    `flag:"--count=N the count"`
+		Verbose bool   `flag:"-v be verbose"`
+	}
+	opts, fs := RegisterNewT[options]("typed")
+	if err := fs.Parse([]string{"--name", "bob", "-v", "--count=3", "arg"}); err != nil {
+		t.Fatal(err)
+	}
+	want := &options{Name: "bob", Count: 3, Verbose: true}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+	if args := fs.Args(); !reflect.DeepEqual(args, []string{"arg"}) {
+		t.Errorf("got args %q, want %q", args, []string{"arg"})
+	}
+
+	defer func() {
+		if s := checkPanic(recover(), "*int is not a pointer to a struct"); s != "" {
+			t.Error(s)
+		}
+	}()
+	RegisterNewT[int]("int")
+	t.Errorf("RegisterNewT[int] did not panic")
+}
+
+func TestHelpEnvironment(t *testing.T) {
+	opts := &struct {
+		Host    string `flag:"--host=HOST {env=APP_HOST} the host"`
+		Port    int    `flag:"--port=PORT {env=APP_PORT} the port"`
+		Verbose bool   `flag:"-v {env=V} be verbose"`
+		Name    string `flag:"--name the name"`
+	}{}
+	want := `
+  --host=HOST     the host
+  --name=VALUE    the name
+  --port=PORT     the port
+   -v             be verbose
+
+Environment:
+  APP_HOST    --host
+  APP_PORT    --port
+  V           -v
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "", "", opts)
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	out.Reset()
+	HelpEnvironment(&out, opts)
+	if got, want := out.String(), want[strings.Index(want, "Environment:"):]; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	out.Reset()
+	HelpEnvironment(&out, &struct{ Name string }{})
+	if got := out.String(); got != "" {
+		t.Errorf("got %q without environment variables, want none", got)
+	}
+}
+
+func TestTryParse(t *testing.T) {
+	type options struct {
+		Name   string            `flag:"--name=NAME the name"`
+		Mode   string            `flag:"--mode=MODE {choices=fast,slow} the mode"`
+		Count  int               `flag:"--count=N the count"`
+		Tags   []string          `flag:"--tag=TAG a tag"`
+		Labels map[string]string `flag:"--label=KEY=VALUE a label"`
+		Sorted []string          `flag:"--sorted=VALUE {sorted} a sorted value"`
+	}
+	orig := options{
+		Name:   "bob",
+		Mode:   "fast",
+		Count:  1,
+		Tags:   []string{"a"},
+		Labels: map[string]string{"a": "1"},
+		Sorted: []string{"z", "y"},
+	}
+	opts := orig
+	// Spare capacity must not be written to.
+	opts.Tags = append(make([]string, 0, 4), orig.Tags...)
+	opts.Labels = map[string]string{"a": "1"}
+	opts.Sorted = append([]string{}, orig.Sorted...)
+	for _, tt := range []struct {
+		args []string
+		err  string
+	}{
+		{args: []string{"--name=alice", "--count=2", "--tag=b", "--mode=slow"}},
+		{args: []string{"--tag=b", "--label=b=2", "--sorted=x"}},
+		{args: []string{"--count=many"}, err: `invalid value "many" for flag -count`},
+		{args: []string{"--mode=quick"}, err: "must be one of fast, slow"},
+		{args: []string{"--unknown"}, err: "flag provided but not defined: -unknown"},
+	} {
+		err := TryParse(&opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+		}
+		if !reflect.DeepEqual(opts, orig) {
+			t.Errorf("%q: options changed to %+v", tt.args, opts)
+		}
+		if spare := opts.Tags[:2][1]; spare != "" {
+			t.Errorf("%q: spare capacity set to %q", tt.args, spare)
+		}
+	}
+	if s := check.Error(TryParse(opts, nil), "is not a pointer to a struct"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestColumnWidth(t *testing.T) {
+	for _, opts := range []any{
+		&struct {
+			Alpha   string `flag:"--alpha=LEVEL the alpha level"`
+			Verbose bool   `flag:"-v be verbose"`
+		}{},
+		&struct {
+			Name string `flag:"--name the name"`
+		}{},
+	} {
+		var out bytes.Buffer
+		Help(&out, "", "", opts)
+		width := ColumnWidth(opts)
+		for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			if len(line) <= width || line[width-1] != ' ' || line[width] == ' ' {
+				t.Errorf("help text of %q does not start in column %d", line, width)
+			}
+		}
+	}
+}
+
+func TestRegisterSetMapped(t *testing.T) {
+	set := NewFlagSet("")
+	if err := RegisterSet("", &struct {
+		Debug bool `flag:"--debug debug mode"`
+	}{}, set); err != nil {
+		t.Fatal(err)
+	}
+	m, err := RegisterSetMapped(&struct {
+		Name     string `flag:"--name=NAME the name"`
+		Verbose  bool   `flag:"-v be verbose"`
+		Count    int
+		Ignored  int    `flag:"-"`
+		Src      string `arg:"SRC the source"`
+		internal int
+	}{}, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Name":    "name",
+		"Verbose": "v",
+		"Count":   "count",
+	}
+	if len(m) != len(want) {
+		t.Errorf("got %d flags, want %d", len(m), len(want))
+	}
+	for field, name := range want {
+		f := m[field]
+		if f == nil {
+			t.Errorf("%s: no flag", field)
+			continue
+		}
+		if f.Name != name {
+			t.Errorf("%s: got flag %q, want %q", field, f.Name, name)
+		}
+	}
+	if f := m["Name"]; f != nil && f.Usage != "the name" {
+		t.Errorf("got usage %q, want %q", f.Usage, "the name")
+	}
+
+	_, err = RegisterSetMapped(&struct{ Name string }{}, noLookupSet{set})
+	if s := check.Error(err, "does not have a Lookup method"); s != "" {
+		t.Error(s)
+	}
+}
+
+// A noLookupSet is a FlagSet without a Lookup method.
+type noLookupSet struct {
+	FlagSet
+}
+
+func TestHelpGrep(t *testing.T) {
+	opts := &struct {
+		Network string `flag:"--network=NAME the network to join"`
+		Addr    string `flag:"--addr=ADDR the NET address"`
+		Verbose bool   `flag:"-v be verbose"`
+		Timeout int    `flag:"--timeout=SECS connection timeout"`
+	}{}
+	for _, tt := range []struct {
+		pattern string
+		want    string
+	}{{
+		pattern: "net",
+		want: `
+  --addr=ADDR       the NET address
+  --network=NAME    the network to join
+`[1:],
+	}, {
+		pattern: "Verb",
+		want: `
+   -v               be verbose
+`[1:],
+	}, {
+		pattern: "missing",
+		want:    "",
+	}} {
+		var out bytes.Buffer
+		HelpGrep(&out, opts, tt.pattern)
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestFieldCache(t *testing.T) {
+	type options struct {
+		Name    string `flag:"--name=NAME the name"`
+		Verbose bool   `flag:"-v"`
+		Count   int
+	}
+	fieldCache.Delete(reflect.TypeOf(options{}))
+	for x, tt := range []struct {
+		args []string
+		want options
+	}{
+		{args: []string{"c", "--name=bob", "-v"}, want: options{Name: "bob", Verbose: true}},
+		{args: []string{"c", "--count=2"}, want: options{Count: 2}},
+	} {
+		var opts options
+		if _, err := SubRegisterAndParse(&opts, tt.args); err != nil {
+			t.Fatalf("registration %d: %v", x, err)
+		}
+		if opts != tt.want {
+			t.Errorf("registration %d: got %+v, want %+v", x, opts, tt.want)
+		}
+		if _, ok := fieldCache.Load(reflect.TypeOf(opts)); !ok {
+			t.Errorf("registration %d: type not cached", x)
+		}
+	}
+	// Registering modifies its copy of the tags, not the cached tags.
+	d, err := Describe(&options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d[1].Help != "" {
+		t.Errorf("got help %q for -v, want none", d[1].Help)
+	}
+
+	// Invalid tags are also cached.
+	bad := &struct {
+		Name string `flag:"--name {bogus}"`
+	}{}
+	for x := 0; x < 2; x++ {
+		_, err := SubRegisterAndParse(bad, []string{"c"})
+		if s := check.Error(err, `unknown attribute "bogus"`); s != "" {
+			t.Errorf("registration %d: %s", x, s)
+		}
+	}
+}
+
+func BenchmarkRegister(b *testing.B) {
+	type options struct {
+		Name    string        `flag:"--name=NAME the name"`
+		Verbose bool          `flag:"-v be verbose"`
+		Count   int           `flag:"--count=N {count} the count"`
+		Timeout time.Duration `flag:"--timeout=DURATION {env=TIMEOUT} the timeout"`
+		Mode    string        `flag:"--mode=MODE {choices=fast,slow} the mode"`
+		Tags    []string      `flag:"--tag=TAG {sorted} a tag"`
+	}
+	typ := reflect.TypeOf(options{})
+	for _, cached := range []bool{true, false} {
+		name := "uncached"
+		if cached {
+			name = "cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if !cached {
+					fieldCache.Delete(typ)
+				}
+				set := NewFlagSet("")
+				if err := register("", &options{}, set); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSetHelpLines(t *testing.T) {
+	defer SetHelpLines(0)
+	defer SetHelpWidth(0)
+	SetHelpWidth(40)
+	opts := &struct {
+		Alpha   string `flag:"--alpha=LEVEL the alpha level"`
+		Beta    int    `flag:"--beta=N {env=BETA} set beta to N"`
+		Gamma   string `flag:"--gamma=RAY a very long description of the gamma option that wraps"`
+		Verbose bool   `flag:"-v be verbose"`
+	}{}
+	full := `
+Usage: xyzzy [--alpha=LEVEL] [--beta=N] [--gamma=RAY] [-v]
+  --alpha=LEVEL    the alpha level
+  --beta=N         set beta to N
+  --gamma=RAY      a very long
+                   description of the
+                   gamma option that
+                   wraps
+   -v              be verbose
+
+Environment:
+  BETA    --beta
+`[1:]
+	for _, tt := range []struct {
+		lines int
+		want  string
+	}{{
+		lines: 0,
+		want:  full,
+	}, {
+		lines: 4,
+		want: `
+Usage: xyzzy [--alpha=LEVEL] [--beta=N] [--gamma=RAY] [-v]
+  --alpha=LEVEL    the alpha level
+  --beta=N         set beta to N
+(run --help-full for all options)
+`[1:],
+	}, {
+		// The wrapped --gamma option is not split.
+		lines: 6,
+		want: `
+Usage: xyzzy [--alpha=LEVEL] [--beta=N] [--gamma=RAY] [-v]
+  --alpha=LEVEL    the alpha level
+  --beta=N         set beta to N
+(run --help-full for all options)
+`[1:],
+	}, {
+		lines: 7,
+		want: `
+Usage: xyzzy [--alpha=LEVEL] [--beta=N] [--gamma=RAY] [-v]
+  --alpha=LEVEL    the alpha level
+  --beta=N         set beta to N
+  --gamma=RAY      a very long
+                   description of the
+                   gamma option that
+                   wraps
+(run --help-full for all options)
+`[1:],
+	}, {
+		// All the options fit.
+		lines: 8,
+		want:  full,
+	}} {
+		SetHelpLines(tt.lines)
+		var out bytes.Buffer
+		Help(&out, "xyzzy", "", opts)
+		if got := out.String(); got != tt.want {
+			t.Errorf("%d lines: got:\n%s\nwant:\n%s", tt.lines, got, tt.want)
+		}
+		out.Reset()
+		HelpFull(&out, "xyzzy", "", opts)
+		if got := out.String(); got != full {
+			t.Errorf("%d lines: HelpFull got:\n%s\nwant:\n%s", tt.lines, got, full)
+		}
+	}
+}
+
+func TestSplitAtTerminator(t *testing.T) {
+	for _, tt := range []struct {
+		args          []string
+		before, after []string
+	}{
+		{
+			args:   []string{"--global", "--", "subcmd", "--sub"},
+			before: []string{"--global"},
+			after:  []string{"subcmd", "--sub"},
+		},
+		{
+			args:   []string{"--global", "--", "subcmd", "--", "x"},
+			before: []string{"--global"},
+			after:  []string{"subcmd", "--", "x"},
+		},
+		{
+			args:   []string{"--", "subcmd"},
+			before: []string{},
+			after:  []string{"subcmd"},
+		},
+		{
+			args:   []string{"--global", "--"},
+			before: []string{"--global"},
+			after:  []string{},
+		},
+		{
+			args:   []string{"--global"},
+			before: []string{"--global"},
+		},
+	} {
+		before, after := SplitAtTerminator(tt.args)
+		if !reflect.DeepEqual(before, tt.before) || !reflect.DeepEqual(after, tt.after) {
+			t.Errorf("%q: got %q, %q, want %q, %q", tt.args, before, after, tt.before, tt.after)
+		}
+	}
+}
+
+func TestSubRegisterAndParseCommand(t *testing.T) {
+	opts := &struct {
+		Global bool `flag:"--global a global flag"`
+		Sub    bool `flag:"--sub not set"`
+	}{}
+	rest, command, err := SubRegisterAndParseCommand(opts, []string{"tool", "--global", "file", "--", "subcmd", "--sub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.Global || opts.Sub {
+		t.Errorf("got %+v, want only global set", opts)
+	}
+	if want := []string{"file"}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("got rest %q, want %q", rest, want)
+	}
+	if want := []string{"subcmd", "--sub"}; !reflect.DeepEqual(command, want) {
+		t.Errorf("got command %q, want %q", command, want)
+	}
+}
+
+func TestCheckParams(t *testing.T) {
+	got := CheckParams(&struct {
+		Name    string        `flag:"--name=NAME the name"`
+		Host    string        `flag:"--host=host the host"`
+		Mixed   string        `flag:"--mixed=Value mixed case"`
+		Timeout time.Duration `flag:"--timeout the timeout"`
+		Verbose bool          `flag:"-v be verbose"`
+		Count   int           `flag:"-c {count} the count"`
+		Port    int
+	}{})
+	want := []string{
+		"--host: parameter host is not upper case",
+		"--mixed: parameter Value is not upper case",
+		"--timeout: takes a value but has no parameter name",
+		"--port: takes a value but has no parameter name",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := CheckParams(&struct {
+		Name string `flag:"--name=NAME the name"`
+	}{}); got != nil {
+		t.Errorf("got %q, want nil", got)
+	}
+	if got := CheckParams("bad"); len(got) != 1 || !strings.Contains(got[0], "not a pointer to a struct") {
+		t.Errorf("got %q", got)
+	}
+}
+
+//go:embed testdata/help
+var helpFiles embed.FS
+
+func TestHelpFile(t *testing.T) {
+	defer SetHelpFS(nil)
+	type options struct {
+		Timeout time.Duration `flag:"--timeout=DURATION {help-file=testdata/help/timeout.txt}"`
+		V       bool          `flag:"-v be verbose"`
+	}
+	_, err := SubRegisterAndParse(&options{}, []string{"c"})
+	if s := check.Error(err, "SetHelpFS has not been called"); s != "" {
+		t.Error(s)
+	}
+
+	SetHelpFS(helpFiles)
+	if _, err := SubRegisterAndParse(&options{}, []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetHelpWidth(0)
+	SetHelpWidth(60)
+	want := `
+Usage: c [--timeout=DURATION] [-v]
+  --timeout=DURATION    The maximum time to wait for the
+                        server to respond before giving up.
+                        A value of 0 waits forever.
+   -v                   be verbose
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "c", "", &options{})
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, tt := range []struct {
+		opts any
+		err  string
+	}{{
+		opts: &struct {
+			Timeout int `flag:"--timeout {help-file=testdata/help/missing.txt}"`
+		}{},
+		err: "help file: open testdata/help/missing.txt",
+	}, {
+		opts: &struct {
+			Timeout int `flag:"--timeout {help-file=testdata/help/timeout.txt} the timeout"`
+		}{},
+		err: "has both help text and {help-file}",
+	}} {
+		_, err := SubRegisterAndParse(tt.opts, []string{"c"})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Error(s)
+		}
+	}
+}
+
+func TestTagDefault(t *testing.T) {
+	type options struct {
+		Level int    `flag:"--level=N {default=3} the level"`
+		Mode  string `flag:"--mode=MODE {default=fast} {choices=fast,slow} the mode"`
+	}
+	for _, tt := range []struct {
+		name  string
+		opts  options
+		args  []string
+		level int
+		mode  string
+	}{{
+		name:  "default",
+		level: 3,
+		mode:  "fast",
+	}, {
+		name:  "flag",
+		args:  []string{"--level=7", "--mode=slow"},
+		level: 7,
+		mode:  "slow",
+	}, {
+		name:  "populated",
+		opts:  options{Level: 5, Mode: "slow"},
+		level: 5,
+		mode:  "slow",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if _, err := SubRegisterAndParse(&opts, append([]string{"c"}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			if opts.Level != tt.level {
+				t.Errorf("got level %d, want %d", opts.Level, tt.level)
+			}
+			if opts.Mode != tt.mode {
+				t.Errorf("got mode %q, want %q", opts.Mode, tt.mode)
+			}
+		})
+	}
+
+	want := `
+Usage: c [--level=N] [--mode=MODE]
+  --level=N      the level [3]
+  --mode=MODE    the mode (one of fast, slow) [fast]
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "c", "", &options{})
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, tt := range []struct {
+		opts any
+		err  string
+	}{{
+		opts: &struct {
+			Level int `flag:"--level=N {default=three}"`
+		}{},
+		err: `invalid default "three" for flag level`,
+	}, {
+		opts: &struct {
+			Mode string `flag:"--mode=MODE {default=medium} {choices=fast,slow}"`
+		}{},
+		err: `invalid default "medium" for flag mode`,
+	}} {
+		_, err := SubRegisterAndParse(tt.opts, []string{"c"})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Error(s)
+		}
+	}
+}
+
+func TestShortAndLong(t *testing.T) {
+	type options struct {
+		Verbose bool   `flag:"-v --verbose be verbose"`
+		Name    string `flag:"--name=NAME -n the name"`
+		Level   int    `flag:"--level=N the level"`
+	}
+	for _, tt := range []struct {
+		args    []string
+		verbose bool
+		name    string
+	}{
+		{[]string{"c"}, false, ""},
+		{[]string{"c", "-v", "-n", "bob"}, true, "bob"},
+		{[]string{"c", "--verbose", "--name=bob"}, true, "bob"},
+		{[]string{"c", "-n", "bob", "--name", "fred"}, false, "fred"},
+	} {
+		opts := &options{}
+		set := NewFlagSet("")
+		if err := RegisterSet("c", opts, set); err != nil {
+			t.Fatal(err)
+		}
+		err := parse(set, tt.args[1:], nil)
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if opts.Verbose != tt.verbose || opts.Name != tt.name {
+			t.Errorf("%q: got %v, %q, want %v, %q", tt.args, opts.Verbose, opts.Name, tt.verbose, tt.name)
+		}
+		if tt.name != "" && (!WasSet(set, "n") || !WasSet(set, "name")) {
+			t.Errorf("%q: name not set", tt.args)
+		}
+	}
+
+	opts := &options{Verbose: true, Name: "bob"}
+	for _, name := range []string{"v", "verbose"} {
+		if v, ok := Lookup(opts, name).(bool); !ok || !v {
+			t.Errorf("Lookup(%q) got %v, want true", name, Lookup(opts, name))
+		}
+	}
+	if got := Lookup(opts, "n"); got != "bob" {
+		t.Errorf("Lookup(n) got %v, want bob", got)
+	}
+
+	want := `
+Usage: c [--level=N] [-n|--name=NAME] [-v|--verbose]
+  --level=N          the level
+  -n, --name=NAME    the name [bob]
+  -v, --verbose      be verbose [true]
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "c", "", opts)
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	errs := ValidateShorts(&options{}, &struct {
+		Count int `flag:"-n the count"`
+	}{})
+	if len(errs) != 1 {
+		t.Fatalf("got errors %v, want 1 error", errs)
+	}
+	if s := check.Error(errs[0], "short flag -n declared by Name (argument 1) and Count (argument 2)"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestParseAnnotated(t *testing.T) {
+	type options struct {
+		Tags []string `flag:"--tag=TAG a tag"`
+		Name string   `flag:"--name=NAME the name"`
+	}
+	for _, tt := range []struct {
+		name string
+		args []AnnotatedArg
+		tags []string
+		rest []string
+	}{{
+		name: "unquoted",
+		args: []AnnotatedArg{{Arg: "--tag"}, {Arg: "a,b"}},
+		tags: []string{"a", "b"},
+	}, {
+		name: "quoted",
+		args: []AnnotatedArg{{Arg: "--tag"}, {Arg: "a,b", Quoted: true}, {Arg: "--tag=c,d"}},
+		tags: []string{"a,b", "c", "d"},
+	}, {
+		name: "quoted attached",
+		args: []AnnotatedArg{{Arg: "--tag=a,b", Quoted: true}},
+		tags: []string{"a,b"},
+	}, {
+		name: "quoted escape",
+		args: []AnnotatedArg{{Arg: "--tag", Quoted: true}, {Arg: `a\,b`, Quoted: true}},
+		tags: []string{`a\,b`},
+	}, {
+		name: "not a list",
+		args: []AnnotatedArg{{Arg: "--name", Quoted: true}, {Arg: "a,b", Quoted: true}, {Arg: "x,y", Quoted: true}},
+		rest: []string{"x,y"},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &options{}
+			rest, err := ParseAnnotated(opts, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(opts.Tags, tt.tags) {
+				t.Errorf("got tags %q, want %q", opts.Tags, tt.tags)
+			}
+			if len(rest) != 0 || len(tt.rest) != 0 {
+				if !reflect.DeepEqual(rest, tt.rest) {
+					t.Errorf("got rest %q, want %q", rest, tt.rest)
+				}
+			}
+		})
+	}
+}
+
+func TestHelpRequiredFirst(t *testing.T) {
+	type options struct {
+		Verbose bool   `flag:"-v be verbose"`
+		Output  string `flag:"--output=FILE {required} the output"`
+		Debug   bool   `flag:"--debug enable debugging"`
+		Input   string `flag:"--input=FILE {required} the input"`
+	}
+	defer SetHelpRequiredFirst(false)
+	SetHelpRequiredFirst(true)
+	want := `
+Usage: c [--output=FILE] [--input=FILE] [-v] [--debug]
+  --output=FILE    the output
+  --input=FILE     the input
+   -v              be verbose
+  --debug          enable debugging
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "c", "", &options{})
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	SetHelpRequiredFirst(false)
+	want = `
+Usage: c [--debug] [--input=FILE] [--output=FILE] [-v]
+  --debug          enable debugging
+  --input=FILE     the input
+  --output=FILE    the output
+   -v              be verbose
+`[1:]
+	out.Reset()
+	Help(&out, "c", "", &options{})
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSet(t *testing.T) {
+	type options struct {
+		Name    string        `flag:"-n --name=NAME the name"`
+		Timeout time.Duration `flag:"--timeout=DURATION the timeout"`
+		Mode    string        `flag:"--mode=MODE {choices=fast,slow} the mode"`
+		Level   int           `flag:"--level=N {min=1} the level"`
+	}
+	opts := &options{}
+	for _, tt := range []struct {
+		name  string
+		value string
+		want  any
+		err   string
+	}{
+		{name: "name", value: "bob", want: "bob"},
+		{name: "n", value: "fred", want: "fred"},
+		{name: "timeout", value: "1m", want: time.Minute},
+		{name: "timeout", value: "soon", err: `invalid value "soon" for flag -timeout: parse error`},
+		{name: "mode", value: "fast", want: "fast"},
+		{name: "mode", value: "quick", err: "must be one of fast, slow"},
+		{name: "level", value: "0", err: `invalid value "0" for flag -level`},
+		{name: "missing", value: "x", err: "unknown flag missing"},
+	} {
+		err := Set(opts, tt.name, tt.value)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s=%s: %s", tt.name, tt.value, s)
+			continue
+		}
+		if err == nil {
+			if got := Lookup(opts, tt.name); got != tt.want {
+				t.Errorf("%s=%s: got %v, want %v", tt.name, tt.value, got, tt.want)
+			}
+		}
+	}
+
+	// Once registered the option is validated as it is when parsed.
+	set := NewFlagSet("")
+	if err := RegisterSet("c", opts, set); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set(opts, "mode", "slow"); err != nil {
+		t.Error(err)
+	}
+	err := Set(opts, "mode", "quick")
+	if s := check.Error(err, "must be one of fast, slow"); s != "" {
+		t.Error(s)
+	}
+	if opts.Mode != "slow" {
+		t.Errorf("got mode %q, want slow", opts.Mode)
+	}
+	if err := Set("bad", "mode", "slow"); err == nil {
+		t.Errorf("did not get an error for bad options")
+	}
+}
+
+func TestHelpNameConflict(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts any
+		err  string
+	}{{
+		name: "help",
+		opts: &struct {
+			Help bool
+		}{},
+		err: "flag name 'help' conflicts with the built-in help flag; use a different name or disable the built-in",
+	}, {
+		name: "h",
+		opts: &struct {
+			Host string `flag:"-h --host=HOST the host"`
+		}{},
+		err: "flag name 'h' conflicts with the built-in help flag",
+	}, {
+		name: "other",
+		opts: &struct {
+			Helper string `flag:"--helper=NAME the helper"`
+		}{},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SubRegisterAndParse(tt.opts, []string{"c"})
+			if s := check.Error(err, tt.err); s != "" {
+				t.Error(s)
+			}
+		})
+	}
+
+	type helpOptions struct {
+		Help bool `flag:"--help display help"`
+	}
+	opts := &helpOptions{}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--help"}, NoBuiltinHelp()); err != nil {
+		t.Fatal(err)
+	}
+	if !opts.Help {
+		t.Errorf("--help was not set")
+	}
+
+	if err := RegisterSet("c", &helpOptions{}, NewFlagSet("")); err == nil {
+		t.Errorf("registered --help with the built-in help enabled")
+	}
+
+	// {help-flag} permits the names for a single option.
+	set := NewFlagSet("")
+	hopts := &struct {
+		Help bool   `flag:"-h --help {help-flag} display help"`
+		Host string `flag:"--host=HOST the host"`
+	}{}
+	if err := RegisterSet("c", hopts, set); err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(set, []string{"-h"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !hopts.Help {
+		t.Errorf("-h was not set")
+	}
+}
+
+func TestRegisterAndParseFile(t *testing.T) {
+	type options struct {
+		Name    string        `flag:"--name=NAME the name"`
+		Timeout time.Duration `flag:"--timeout=DURATION the timeout"`
+		Verbose bool          `flag:"-v be verbose"`
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte(`{"name": "bob", "timeout": "1m", "Verbose": true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"name": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.json")
+	for _, tt := range []struct {
+		name     string
+		path     string
+		optional bool
+		args     []string
+		want     options
+		err      string
+	}{{
+		name: "file",
+		path: config,
+		want: options{Name: "bob", Timeout: time.Minute, Verbose: true},
+	}, {
+		name: "override",
+		path: config,
+		args: []string{"--name=fred", "-v=false"},
+		want: options{Name: "fred", Timeout: time.Minute},
+	}, {
+		name:     "optional",
+		path:     missing,
+		optional: true,
+		args:     []string{"--name=fred"},
+		want:     options{Name: "fred"},
+	}, {
+		name: "missing",
+		path: missing,
+		err:  "no such file or directory",
+	}, {
+		name:     "malformed",
+		path:     bad,
+		optional: true,
+		err:      bad + ": unexpected end of JSON input",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			CommandLine = NewFlagSet("")
+			os.Args = append([]string{"command"}, tt.args...)
+			var opts options
+			_, err := RegisterAndParseFile(&opts, tt.path, tt.optional)
+			if s := check.Error(err, tt.err); s != "" {
+				t.Fatal(s)
+			}
+			if opts != tt.want {
+				t.Errorf("got %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestHidden(t *testing.T) {
+	type options struct {
+		Name     string `flag:"--name=NAME the name"`
+		Internal string `flag:"--internal=VALUE {hidden} an internal setting"`
+	}
+	opts := &options{}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--name", "bob", "--internal", "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Internal != "x" {
+		t.Errorf("got internal %q, want x", opts.Internal)
+	}
+	if got := Lookup(opts, "internal"); got != "x" {
+		t.Errorf("Lookup got %v, want x", got)
+	}
+	if err := Set(opts, "internal", "y"); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Internal != "y" {
+		t.Errorf("got internal %q, want y", opts.Internal)
+	}
+
+	var help bytes.Buffer
+	Help(&help, "c", "", opts)
+	want := `
+Usage: c [--name=NAME]
+  --name=NAME    the name [bob]
+`[1:]
+	if got := help.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	descs, err := Describe(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !descs[1].Hidden {
+		t.Errorf("internal is not described as hidden")
+	}
+}
+
+type tlsOptions struct {
+	Cert    string `flag:"--cert=PATH the certificate"`
+	Key     string `flag:"--key=PATH the private key"`
+	Ignored string `flag:"-"`
+	Client  struct {
+		CA string `flag:"--ca=PATH the client CA"`
+	} `flag:"client"`
+}
+
+func TestGroups(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Name    string     `flag:"--name=NAME the name"`
+		TLS     tlsOptions `flag:"tls"`
+		Ignored tlsOptions `flag:"-"`
+	}
+	opts := &options{}
+	opts.TLS.Cert = "default.pem"
+	opts.TLS.Ignored = "ignored"
+	args := []string{"c", "--tls.key", "key.pem", "--tls.client.ca=ca.pem", "--name", "bob"}
+	if _, err := SubRegisterAndParse(opts, args); err != nil {
+		t.Fatal(err)
+	}
+	want := &options{Name: "bob"}
+	want.TLS.Cert = "default.pem"
+	want.TLS.Key = "key.pem"
+	want.TLS.Ignored = "ignored"
+	want.TLS.Client.CA = "ca.pem"
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+	if got := Lookup(opts, "tls.client.ca"); got != "ca.pem" {
+		t.Errorf("Lookup got %v, want ca.pem", got)
+	}
+	if _, err := SubRegisterAndParse(&options{}, []string{"c", "--ignored.cert", "x"}); err == nil {
+		t.Errorf("did not get an error for a pruned group")
+	}
+
+	d := Dup(opts).(*options)
+	if d.TLS.Key != "key.pem" || d.TLS.Client.CA != "ca.pem" || d.TLS.Ignored != "" {
+		t.Errorf("Dup got %+v", d)
+	}
+
+	var help bytes.Buffer
+	Help(&help, "c", "", &options{})
+	wantHelp := `
+Usage: c [--name=NAME] [--tls.cert=PATH] [--tls.client.ca=PATH] [--tls.key=PATH]
+  --name=NAME        the name
+  --tls.cert=PATH    the certificate
+  --tls.client.ca=PATH
+                     the client CA
+  --tls.key=PATH     the private key
+`[1:]
+	if got := help.String(); got != wantHelp {
+		t.Errorf("got:\n%s\nwant:\n%s", got, wantHelp)
+	}
+
+	func() {
+		defer func() {
+			if s := checkPanic(recover(), "flag group group: flag --verbose may not have a short name"); s != "" {
+				t.Error(s)
+			}
+		}()
+		Validate(&struct {
+			Group struct {
+				V bool `flag:"-v --verbose be verbose"`
+			} `flag:"group"`
+		}{})
+	}()
+}
+
+type CommonFlags struct {
+	Verbose bool   `flag:"-v be verbose"`
+	Config  string `flag:"--config=PATH the configuration file"`
+}
+
+type debugFlags struct {
+	Debug bool `flag:"--debug enable debugging"`
+}
+
+// nestedFields are the non-option fields of an embedded structure.
+type nestedFields struct {
+	Flags  int      `flag:"{flag-count}"`
+	RawDir string   `flag:"{raw-of=dir}"`
+	Files  []string `arg:"[FILE...] the files"`
+}
+
+func TestNestedFields(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		nestedFields
+		Dir   string `flag:"--dir=PATH the directory"`
+		Cache struct {
+			Size    int    `flag:"--size=N the size"`
+			RawSize string `flag:"{raw-of=size}"`
+		} `flag:"cache"`
+	}
+	opts := &options{}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--dir", "/tmp", "--cache.size=0x10", "a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Flags != 2 {
+		t.Errorf("got flag count %d, want 2", opts.Flags)
+	}
+	if opts.RawDir != "/tmp" {
+		t.Errorf("got raw dir %q, want /tmp", opts.RawDir)
+	}
+	if opts.Cache.Size != 16 || opts.Cache.RawSize != "0x10" {
+		t.Errorf("got size %d and raw size %q, want 16 and 0x10", opts.Cache.Size, opts.Cache.RawSize)
+	}
+	if !reflect.DeepEqual(opts.Files, []string{"a", "b"}) {
+		t.Errorf("got files %q, want [a b]", opts.Files)
+	}
+	if got, want := UsageLine("c", "", opts), "c [--cache.size=N] [--dir=PATH] [FILE...]"; got != want {
+		t.Errorf("got usage line %q, want %q", got, want)
+	}
+
+	_, err := SubRegisterAndParse(&struct {
+		Group struct {
+			Raw string `flag:"{raw-of=missing}"`
+		} `flag:"group"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{raw-of=group.missing} names an unknown flag"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	type options struct {
+		CommonFlags
+		debugFlags
+		Extra string `flag:"--extra=VALUE an extra option"`
+	}
+	opts := &options{}
+	opts.Config = "default.conf"
+	if _, err := SubRegisterAndParse(opts, []string{"c", "-v", "--debug", "--extra", "x"}); err != nil {
+		t.Fatal(err)
+	}
+	want := &options{Extra: "x"}
+	want.Verbose = true
+	want.Config = "default.conf"
+	want.Debug = true
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+	if got := Lookup(opts, "config"); got != "default.conf" {
+		t.Errorf("Lookup got %v, want default.conf", got)
+	}
+	if d := Dup(opts); !reflect.DeepEqual(d, want) {
+		t.Errorf("Dup got %+v, want %+v", d, want)
+	}
+	if got, want := UsageLine("c", "", opts), "c [--config=PATH] [--debug] [--extra=VALUE] [-v]"; got != want {
+		t.Errorf("got usage line %q, want %q", got, want)
+	}
+
+	func() {
+		defer func() {
+			if s := checkPanic(recover(), `duplicate flag name "v" on fields CommonFlags.Verbose and V`); s != "" {
+				t.Error(s)
+			}
+		}()
+		Validate(&struct {
+			CommonFlags
+			V bool
+		}{})
+	}()
+}
+
+func TestDuplicateNames(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts any
+		err  string
+	}{{
+		name: "explicit and derived",
+		opts: &struct {
+			Name  string
+			Other string `flag:"--name=NAME another name"`
+		}{},
+		err: `duplicate flag name "name" on fields Name and Other`,
+	}, {
+		name: "short",
+		opts: &struct {
+			Verbose bool `flag:"-v --verbose be verbose"`
+			V       bool
+		}{},
+		err: `duplicate flag name "v" on fields Verbose and V`,
+	}, {
+		name: "short and long",
+		opts: &struct {
+			N     int
+			Count int `flag:"--count -n=N the count"`
+		}{},
+		err: `duplicate flag name "n" on fields N and Count`,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RegisterSet("c", tt.opts, NewFlagSet(""))
+			if s := check.Error(err, tt.err); s != "" {
+				t.Error(s)
+			}
+			defer func() {
+				if s := checkPanic(recover(), tt.err); s != "" {
+					t.Error(s)
+				}
+			}()
+			Validate(tt.opts)
+		})
+	}
+
+	// Options registered in the same set may not share names.
+	set := NewFlagSet("")
+	if err := RegisterSet("c", &struct {
+		Name string `flag:"--name=NAME the name"`
+	}{}, set); err != nil {
+		t.Fatal(err)
+	}
+	err := RegisterSet("c", &struct {
+		Other string `flag:"--name=NAME the other name"`
+	}{}, set)
+	if s := check.Error(err, `duplicate flag name "name" on fields Name and Other`); s != "" {
+		t.Error(s)
+	}
+
+	// Nor may they share names with flags defined by other means.
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.Bool("debug", false, "enable debugging")
+	err = RegisterSet("c", &struct {
+		Debug bool `flag:"--debug enable debugging"`
+	}{}, fs)
+	if s := check.Error(err, `duplicate flag name "debug" on field Debug`); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestTagErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts any
+		err  string
+	}{{
+		name: "one",
+		opts: &struct {
+			Name string `flag:"the_name"`
+		}{},
+		err: `flag tag missing option name: "the_name"`,
+	}, {
+		name: "tags",
+		opts: &struct {
+			Name   string `flag:"the_name"`
+			Names  string `flag:"-a -b -c too many"`
+			Other  string `flag:"--name=NAME ok"`
+			Shadow string `flag:"--name another name"`
+			Group  struct {
+				Bad string `flag:"--bad {bogus} bad attribute"`
+			} `flag:"group"`
+		}{},
+		err: `
+4 problems with options:
+	Name: flag tag missing option name: "the_name"
+	Names: flag tag has too many names: "-a -b -c too many"
+	Group.Bad: flag tag has unknown attribute "bogus": "--bad {bogus} bad attribute"
+	Shadow: duplicate flag name "name" on fields Other and Shadow`[1:],
+	}, {
+		name: "duplicates",
+		opts: &struct {
+			Name  string
+			Other string `flag:"--name another name"`
+			N     int
+			Count int `flag:"-n --count the count"`
+		}{},
+		err: `
+2 problems with options:
+	Other: duplicate flag name "name" on fields Name and Other
+	Count: duplicate flag name "n" on fields N and Count`[1:],
+	}, {
+		name: "types",
+		opts: &struct {
+			C    chan int      `flag:"--c a channel"`
+			Name string        `flag:"--name the name"`
+			F    func()        `flag:"--f a function"`
+			D    time.Duration `flag:"--d {default=forever} a duration"`
+		}{},
+		err: `
+3 problems with options:
+	C: invalid option type: chan int
+	F: invalid option type: func()
+	D: invalid default "forever" for flag d: parse error`[1:],
+	}, {
+		name: "tags-and-types",
+		opts: &struct {
+			Names string         `flag:"-a -b -c too many"`
+			C     chan int       `flag:"--c a channel"`
+			M     map[int]string `flag:"--m a map"`
+			E     string         `flag:"--e valid"`
+		}{},
+		err: `
+3 problems with options:
+	Names: flag tag has too many names: "-a -b -c too many"
+	C: invalid option type: chan int
+	M: invalid option type: map[int]string`[1:],
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateError(tt.opts)
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("got error:\n%v\nwant:\n%s", err, tt.err)
+			}
+			set := flag.NewFlagSet("", flag.ContinueOnError)
+			err = RegisterSet("c", tt.opts, set)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("RegisterSet got error:\n%v\nwant:\n%s", err, tt.err)
+			}
+			// Nothing is registered when there is a problem.
+			n := 0
+			set.VisitAll(func(*flag.Flag) { n++ })
+			if n != 0 {
+				t.Errorf("RegisterSet registered %d flags", n)
+			}
+			if lookupSetInfo(set) != nil {
+				t.Errorf("RegisterSet retained the set")
+			}
+		})
+	}
+
+	var errs TagErrors
+	err := ValidateError(&struct {
+		A string `flag:"a"`
+		B string `flag:"b"`
+	}{})
+	if !errors.As(err, &errs) || len(errs) != 2 || errs[1].Field != "B" {
+		t.Errorf("got %#v, want TagErrors", err)
+	}
+}
+
+func TestHelpSections(t *testing.T) {
+	opts := &struct {
+		Verbose bool   `flag:"-v be verbose"`
+		Key     string `flag:"--key=FILE {section=TLS} the private key"`
+		Cert    string `flag:"--cert=FILE {section=TLS} the certificate"`
+		Addr    string `flag:"--addr=ADDR {section=Network} the address"`
+		Name    string `flag:"--name=NAME the name"`
+	}{}
+	want := `
+Usage: c [--addr=ADDR] [--cert=FILE] [--key=FILE] [--name=NAME] [-v]
+
+Options:
+   -v            be verbose
+  --name=NAME    the name
+
+TLS:
+  --key=FILE     the private key
+  --cert=FILE    the certificate
+
+Network:
+  --addr=ADDR    the address
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "c", "", opts)
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Help is limited to whole options.
+	SetHelpLines(6)
+	defer SetHelpLines(0)
+	want = `
+Usage: c [--addr=ADDR] [--cert=FILE] [--key=FILE] [--name=NAME] [-v]
+
+Options:
+   -v            be verbose
+  --name=NAME    the name
+(run --help-full for all options)
+`[1:]
+	out.Reset()
+	Help(&out, "c", "", opts)
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import "sync"
+
+// defaultMessages are the fixed strings used by Help, keyed by the names
+// accepted by SetMessages.
+var defaultMessages = map[string]string{
+	"usage":       "Usage:",
+	"environment": "Environment:",
+	"version":     "version",
+	"commit":      "commit",
+	"built":       "built",
+	"more":        "(run --help-full for all options)",
+	"oneof":       "one of",
+	"deprecated":  "deprecated",
+	"options":     "options",
+	"section":     "Options:",
+}
+
+var (
+	messagesMu sync.Mutex
+	messages   map[string]string
+)
+
+// SetMessages replaces the fixed strings generated by this package, such as
+// the "Usage:" prefix of Help, with the strings in m.  This enables the
+// strings to be translated.  The keys of m are:
+//
+//	usage        "Usage:"        prefix of the usage line
+//	environment  "Environment:"  header of the environment variables
+//	version      "version"       in the version header
+//	commit       "commit"        in the version header
+//	built        "built"         in the version header
+//	more         "(run --help-full for all options)"
+//	                             when Help is limited by SetHelpLines
+//	oneof        "one of"        before the choices of an option
+//	deprecated   "deprecated"    after the help of a deprecated option
+//	options      "options"       in place of the options, see CompactUsageLine
+//	section      "Options:"      header of the options without a {section}
+//
+// Keys missing from m use the default strings.  Calling SetMessages with a
+// nil map restores all the defaults.
+func SetMessages(m map[string]string) {
+	messagesMu.Lock()
+	defer messagesMu.Unlock()
+	messages = make(map[string]string, len(m))
+	for k, v := range m {
+		messages[k] = v
+	}
+}
+
+// message returns the string for key.
+func message(key string) string {
+	messagesMu.Lock()
+	defer messagesMu.Unlock()
+	if s, ok := messages[key]; ok {
+		return s
+	}
+	return defaultMessages[key]
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetMessages(t *testing.T) {
+	defer SetMessages(nil)
+	defer SetVersion("", "", "")
+	opts := &struct {
+		Host string `flag:"--host=HOST {env=HOST} l'hôte"`
+	}{}
+	SetMessages(map[string]string{
+		"usage":       "Utilisation:",
+		"environment": "Environnement :",
+		"built":       "compilé",
+	})
+	SetVersion("1.0", "", "2023-04-01")
+	want := `
+xyzzy version 1.0 (compilé 2023-04-01)
+Utilisation: xyzzy [--host=HOST]
+  --host=HOST    l'hôte
+
+Environnement :
+  HOST    --host
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "xyzzy", "", opts)
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	SetMessages(nil)
+	SetVersion("", "", "")
+	out.Reset()
+	Help(&out, "xyzzy", "", &struct{}{})
+	if got, want := out.String(), "Usage: xyzzy\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"strings"
+)
+
+// OpenAPIParameters returns the options declared by opts as a list of OpenAPI
+// parameter objects.  Each option is described as a query parameter, e.g.:
+//
+//	{
+//		"name": "count",
+//		"in": "query",
+//		"description": "number of widgets",
+//		"required": false,
+//		"schema": {"type": "integer"}
+//	}
+//
+// The schema includes an enum for options with the {choices} attribute.
+// Options with the {hidden} attribute are not included.  nil is returned if
+// opts is not a valid options structure.
+func OpenAPIParameters(opts any) []map[string]any {
+	descs, err := Describe(opts)
+	if err != nil {
+		return nil
+	}
+	params := make([]map[string]any, 0, len(descs))
+	for _, d := range descs {
+		if d.Hidden {
+			continue
+		}
+		schema := openAPISchema(d.Type)
+		if len(d.Choices) > 0 {
+			schema["enum"] = d.Choices
+		}
+		params = append(params, map[string]any{
+			"name":        d.Name,
+			"in":          "query",
+			"description": d.Help,
+			"required":    d.Required,
+			"schema":      schema,
+		})
+	}
+	return params
+}
+
+// openAPISchema returns the OpenAPI schema for the Go type named typ.
+func openAPISchema(typ string) map[string]any {
+	if elem := strings.TrimPrefix(typ, "[]"); elem != typ {
+		return map[string]any{
+			"type":  "array",
+			"items": openAPISchema(elem),
+		}
+	}
+	switch typ {
+	case "bool", "atomic.Bool":
+		return map[string]any{"type": "boolean"}
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64",
+		"atomic.Int32", "atomic.Int64", "atomic.Uint32", "atomic.Uint64":
+		return map[string]any{"type": "integer"}
+	case "float32", "float64":
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{"type": "string"}
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOpenAPIParameters(t *testing.T) {
+	opts := &struct {
+		Name  string   `flag:"--name=NAME {required} the name"`
+		Count int      `flag:"--count=N the count"`
+		Rate  float64  `flag:"--rate the rate"`
+		Fast  bool     `flag:"--fast go fast"`
+		Mode  string   `flag:"--mode {choices=a,b} the mode"`
+		Tags  []string `flag:"--tag=TAG a tag"`
+		Debug bool     `flag:"--debug {hidden} debug mode"`
+	}{}
+	got := OpenAPIParameters(opts)
+	param := func(name, desc string, required bool, schema map[string]any) map[string]any {
+		return map[string]any{
+			"name":        name,
+			"in":          "query",
+			"description": desc,
+			"required":    required,
+			"schema":      schema,
+		}
+	}
+	want := []map[string]any{
+		param("name", "the name", true, map[string]any{"type": "string"}),
+		param("count", "the count", false, map[string]any{"type": "integer"}),
+		param("rate", "the rate", false, map[string]any{"type": "number"}),
+		param("fast", "go fast", false, map[string]any{"type": "boolean"}),
+		param("mode", "the mode", false, map[string]any{"type": "string", "enum": []string{"a", "b"}}),
+		param("tag", "a tag", false, map[string]any{"type": "array", "items": map[string]any{"type": "string"}}),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%v\nwant:\n%v", got, want)
+	}
+	if got := OpenAPIParameters("bad"); got != nil {
+		t.Errorf("got %v for bad options, want nil", got)
+	}
+}
@@ -0,0 +1,956 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// A FieldError is returned when parsing fails because a flag could not be set
+// to the value provided.  It identifies the field in the options structure
+// as well as the flag.  Use errors.As to retrieve a FieldError.
+type FieldError struct {
+	Field string // Name of the field in the options structure
+	Flag  string // Name of the flag
+	Value string // The value the flag could not be set to
+	Err   error  // The error returned when setting the value
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("invalid value %q for flag -%s: %v", e.Value, e.Flag, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// A flagValue is the Value registered with a FlagSet for each option.  It
+// wraps the Value that sets the option's field.
+type flagValue struct {
+	Value             // the Value that sets the field
+	field string      // name of the field
+	name  string      // name of the flag
+	short string      // short name of the flag, if it also has one
+	opts  any         // the options structure containing the field
+	info  *setInfo    // the set the option is registered with
+	err   *FieldError // set when Value.Set fails
+	seen  bool        // set by the most recent parse
+
+	// required is set when the option has the {required} attribute.
+	required bool
+
+	// count is set when the option has the {count} attribute.
+	count bool
+
+	// list is set when the option is an []string that splits its values at
+	// commas.
+	list bool
+
+	// together is the name of the option's {together} group, if any.
+	together string
+
+	// envErr is set when the value of the option's environment variable is
+	// invalid.  It is reported by parse unless the option is set.
+	envErr *FieldError
+
+	// origin is where the value of the option came from, or "" if it has
+	// its default value.  An origin of OriginFlag is cleared by each parse.
+	origin Origin
+
+	// value is the field and def is a copy of its value when it was
+	// registered.  They are used by Reset.
+	value reflect.Value
+	def   reflect.Value
+}
+
+func (f *flagValue) Set(s string) error {
+	if err := f.Value.Set(s); err != nil {
+		f.err = &FieldError{Field: f.field, Flag: f.name, Value: s, Err: err}
+		return err
+	}
+	f.seen = true
+	f.origin = OriginFlag
+	return nil
+}
+
+// setEnv sets f from the environment variable named by the {env} attribute in
+// o, if the variable is set.
+func (f *flagValue) setEnv(o *optTag) {
+	name := o.attrs["env"]
+	if name == "" {
+		return
+	}
+	s := os.Getenv(name)
+	if s == "" {
+		return
+	}
+	if err := f.Value.Set(s); err != nil {
+		f.envErr = &FieldError{Field: f.field, Flag: f.name, Value: s, Err: fmt.Errorf("from environment variable %s: %w", name, err)}
+		return
+	}
+	f.origin = OriginEnv
+}
+
+// String returns the string value of f.  The standard flag package may call
+// String on a zero flagValue.
+func (f *flagValue) String() string {
+	if f.Value == nil {
+		return ""
+	}
+	return f.Value.String()
+}
+
+// Get returns the value of f if the wrapped Value has a Get method.
+func (f *flagValue) Get() any {
+	return getValue(f.Value)
+}
+
+// IsBoolFlag reports whether f is a boolean flag, i.e., one that does not
+// require a value.
+func (f *flagValue) IsBoolFlag() bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// isSet reports whether f was set on the command line by the most recent
+// parse, from its environment variable, or by a Source.
+func (f *flagValue) isSet() bool {
+	return f.origin != ""
+}
+
+// dashed returns the name of f as it is used on the command line, e.g., -v
+// or --verbose.
+func (f *flagValue) dashed() string {
+	if len(f.name) == 1 {
+		return "-" + f.name
+	}
+	return "--" + f.name
+}
+
+// checkRequired returns an error naming each of the required options in values
+// that was not set on the command line, from its environment variable, or by
+// a Source.
+func checkRequired(values []*flagValue) error {
+	var missing []string
+	for _, v := range values {
+		if v.required && !v.isSet() {
+			missing = append(missing, v.dashed())
+		}
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("missing required flag %s", missing[0])
+	}
+	return fmt.Errorf("missing required flags %s", strings.Join(missing, ", "))
+}
+
+// checkTogether returns an error if some, but not all, of the options in
+// values that are in the same {together} group are set.  The error names the
+// options that are not set.
+func checkTogether(values []*flagValue) error {
+	var groups []string
+	set := map[string]bool{}
+	for _, v := range values {
+		if v.together == "" {
+			continue
+		}
+		if _, ok := set[v.together]; !ok {
+			groups = append(groups, v.together)
+		}
+		set[v.together] = set[v.together] || v.isSet()
+	}
+	for _, group := range groups {
+		if !set[group] {
+			continue
+		}
+		var missing []string
+		for _, v := range values {
+			if v.together == group && !v.isSet() {
+				missing = append(missing, v.dashed())
+			}
+		}
+		switch len(missing) {
+		case 0:
+		case 1:
+			return fmt.Errorf("missing flag %s of group %s", missing[0], group)
+		default:
+			return fmt.Errorf("missing flags %s of group %s", strings.Join(missing, ", "), group)
+		}
+	}
+	return nil
+}
+
+// A ParseOption modifies how RegisterAndParse and SubRegisterAndParse parse
+// their arguments.
+type ParseOption func(*parseConfig)
+
+// A parseConfig is the configuration built from a list of ParseOptions.
+type parseConfig struct {
+	preParsers   []func(any) error
+	strictArgs   bool
+	windows      bool
+	strictDashes bool
+	unknown      *[]string // set by AllowUnknownFlags
+	prefixes     bool
+	bundled      bool
+	profiles     map[string]map[string]string
+	ignoreCase   bool
+	userHelp     bool // set by NoBuiltinHelp
+
+	// info describes the set the options were registered with by
+	// register.
+	info *setInfo
+}
+
+// newParseConfig returns the configuration specified by opts.
+func newParseConfig(opts []ParseOption) *parseConfig {
+	c := &parseConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// register registers i with set as RegisterSet does, permitting options
+// named help or h if c is from NoBuiltinHelp.  The information about set is
+// recorded in c for parse, which is needed if i only declares positional
+// arguments.
+func (c *parseConfig) register(name string, i any, set FlagSet) error {
+	info, err := registerContext(nil, name, i, set, c.userHelp)
+	if err != nil {
+		return err
+	}
+	c.info = info
+	return nil
+}
+
+// NoBuiltinHelp returns a ParseOption that permits the options registered by
+// functions such as SubRegisterAndParse to be named help or h, as if each
+// option had the {help-flag} attribute.
+func NoBuiltinHelp() ParseOption {
+	return func(c *parseConfig) {
+		c.userHelp = true
+	}
+}
+
+// PreParse returns a ParseOption that calls fn with the options structure
+// after it has been registered but before the arguments are parsed.  fn may
+// set fields in the options structure to provide defaults that can then be
+// overridden by the arguments.  If fn returns an error parsing is not
+// performed and the error is returned.
+func PreParse(fn func(opts any) error) ParseOption {
+	return func(c *parseConfig) {
+		c.preParsers = append(c.preParsers, fn)
+	}
+}
+
+// StrictArgs returns a ParseOption that causes parsing to fail if there are
+// any arguments remaining after the flags that are not claimed by a
+// positional argument.  StrictArgs is normally used by commands that accept
+// no positional arguments.
+func StrictArgs() ParseOption {
+	return func(c *parseConfig) {
+		c.strictArgs = true
+	}
+}
+
+// WindowsStyle returns a ParseOption that also accepts flags in the style of
+// Windows commands, where flags are introduced by a slash and values are
+// separated by a colon, e.g., "/verbose" and "/name:bob" are the same as
+// "--verbose" and "--name=bob".  Both styles may be used in the same command
+// line.  An argument that starts with a slash is only treated as a flag if it
+// names a registered flag so paths such as "/tmp" are not mistaken for flags.
+func WindowsStyle() ParseOption {
+	return func(c *parseConfig) {
+		c.windows = true
+	}
+}
+
+// windowsArgs returns args with the Windows style flags known to info
+// rewritten as "--name" or "--name=value".  Arguments following "--" are not
+// rewritten.
+func windowsArgs(info *setInfo, args []string) []string {
+	nargs := make([]string, len(args))
+	copy(nargs, args)
+	for i, arg := range nargs {
+		if arg == "--" {
+			break
+		}
+		if len(arg) < 2 || arg[0] != '/' {
+			continue
+		}
+		name, value, ok := strings.Cut(arg[1:], ":")
+		if info.lookup(name) == nil {
+			continue
+		}
+		if ok {
+			nargs[i] = "--" + name + "=" + value
+		} else {
+			nargs[i] = "--" + name
+		}
+	}
+	return nargs
+}
+
+// IgnoreCase returns a ParseOption that matches long flag names on the
+// command line regardless of case, e.g., --Verbose and --VERBOSE are the same
+// as --verbose.  Help continues to display the names as declared.  Single
+// character names, such as -v and -V, are always distinct.  Parsing fails if
+// two long names registered with the flag set differ only in case.
+func IgnoreCase() ParseOption {
+	return func(c *parseConfig) {
+		c.ignoreCase = true
+	}
+}
+
+// checkFoldedNames returns an error if the long names of two of the flags
+// registered with info differ only in case.
+func checkFoldedNames(info *setInfo) error {
+	for i, v := range info.values {
+		if len(v.name) < 2 {
+			continue
+		}
+		for _, prev := range info.values[:i] {
+			if prev.name != v.name && strings.EqualFold(prev.name, v.name) {
+				return fmt.Errorf("flag --%s conflicts with --%s when case is ignored", v.name, prev.name)
+			}
+		}
+	}
+	return nil
+}
+
+// foldArgs returns args with the long flags that match a flag known to info
+// only when case is ignored rewritten to use the name of the flag, e.g.,
+// "--Verbose" is rewritten as "--verbose".  Only the flags preceding the first
+// non-flag argument or "--" are rewritten.
+func foldArgs(info *setInfo, args []string) []string {
+	nargs := make([]string, len(args))
+	copy(nargs, args)
+	for i := 0; i < len(nargs); i++ {
+		arg := nargs[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		dashes := "-"
+		if arg[1] == '-' {
+			dashes = "--"
+		}
+		name, value, hasValue := strings.Cut(arg[len(dashes):], "=")
+		v := info.lookup(name)
+		if v == nil && len(name) > 1 {
+			for _, fv := range info.values {
+				if strings.EqualFold(fv.name, name) {
+					v = fv
+					nargs[i] = dashes + fv.name
+					if hasValue {
+						nargs[i] += "=" + value
+					}
+					break
+				}
+			}
+		}
+		if v != nil && !hasValue && !v.IsBoolFlag() {
+			i++
+		}
+	}
+	return nargs
+}
+
+// countArgs returns args with repeated single character {count} flags, such
+// as -vvv, rewritten as -v -v -v.  Only the flags preceding the first
+// non-flag argument or "--" are rewritten.
+func countArgs(info *setInfo, args []string) []string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if v := info.lookup(name); v != nil {
+			if !hasValue && !v.IsBoolFlag() {
+				i++
+			}
+			continue
+		}
+		if arg[1] == '-' || hasValue || name == "" || strings.Trim(name, name[:1]) != "" {
+			continue
+		}
+		if v := info.lookup(name[:1]); v == nil || !v.count {
+			continue
+		}
+		nargs := make([]string, 0, len(args)+len(name)-1)
+		nargs = append(nargs, args[:i]...)
+		for j := 0; j < len(name); j++ {
+			nargs = append(nargs, "-"+name[:1])
+		}
+		args = append(nargs, args[i+1:]...)
+		i += len(name) - 1
+	}
+	return args
+}
+
+// quotedArgs returns the arguments in args with the commas in the quoted
+// values of []string options escaped so the values are not split.  Only the
+// flags preceding the first non-flag argument or "--" are considered.
+func quotedArgs(info *setInfo, args []AnnotatedArg) []string {
+	nargs := make([]string, len(args))
+	for i, arg := range args {
+		nargs[i] = arg.Arg
+	}
+	escape := func(s string) string {
+		return strings.ReplaceAll(s, ",", `\,`)
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i].Arg
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		v := info.lookup(name)
+		switch {
+		case v == nil:
+		case hasValue:
+			if v.list && args[i].Quoted {
+				nargs[i] = arg[:len(arg)-len(value)] + escape(value)
+			}
+		case !v.IsBoolFlag() && i+1 < len(args):
+			i++
+			if v.list && args[i].Quoted {
+				nargs[i] = escape(args[i].Arg)
+			}
+		}
+	}
+	return nargs
+}
+
+// StrictDashes returns a ParseOption that requires options with long names
+// to be introduced by two dashes and options with single character names by
+// one, e.g., --name and -n.  The standard flag package otherwise accepts
+// -name as well as --name.
+func StrictDashes() ParseOption {
+	return func(c *parseConfig) {
+		c.strictDashes = true
+	}
+}
+
+// AllowPrefixes returns a ParseOption that accepts an unambiguous prefix of a
+// long flag name in place of the name, e.g., --tim for --timeout.  A prefix
+// of more than one name is an error.  Only flags introduced by two dashes are
+// matched by prefix.
+func AllowPrefixes() ParseOption {
+	return func(c *parseConfig) {
+		c.prefixes = true
+	}
+}
+
+// prefixArgs returns args with the long flags that are a prefix of the name of
+// exactly one flag known to info rewritten to use that name.  Case is ignored
+// if fold is true.  An error is returned if a prefix matches more than one
+// name.  Only the flags preceding the first non-flag argument or "--" are
+// rewritten.
+func prefixArgs(info *setInfo, args []string, fold bool) ([]string, error) {
+	nargs := make([]string, len(args))
+	copy(nargs, args)
+	for i := 0; i < len(nargs); i++ {
+		arg := nargs[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		v := info.lookup(name)
+		if v == nil && strings.HasPrefix(arg, "--") && name != "" {
+			var matches []*flagValue
+			for _, fv := range info.values {
+				if len(fv.name) > 1 && hasPrefix(fv.name, name, fold) {
+					matches = append(matches, fv)
+				}
+			}
+			switch len(matches) {
+			case 0:
+			case 1:
+				v = matches[0]
+				nargs[i] = "--" + v.name
+				if hasValue {
+					nargs[i] += "=" + value
+				}
+			default:
+				names := make([]string, len(matches))
+				for x, m := range matches {
+					names[x] = "--" + m.name
+				}
+				sort.Strings(names)
+				return nil, fmt.Errorf("ambiguous flag --%s matches %s", name, strings.Join(names, ", "))
+			}
+		}
+		if v != nil && !hasValue && !v.IsBoolFlag() {
+			i++
+		}
+	}
+	return nargs, nil
+}
+
+// hasPrefix reports whether name starts with prefix, ignoring case if fold is
+// true.
+func hasPrefix(name, prefix string, fold bool) bool {
+	if fold {
+		return len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(name, prefix)
+}
+
+// BundledShorts returns a ParseOption that accepts single character boolean
+// flags bundled together, e.g., -abc is the same as -a -b -c.  The last flag
+// in a bundle may take a value, which is the following argument, e.g.,
+// "-abf value" is the same as "-a -b -f value".  An argument is only
+// unbundled if it is not the name of a flag and each character names a
+// single character flag.
+func BundledShorts() ParseOption {
+	return func(c *parseConfig) {
+		c.bundled = true
+	}
+}
+
+// bundledArgs returns args with the bundled single character flags known to
+// info, such as -abc, rewritten as -a -b -c.  Only the flags preceding the
+// first non-flag argument or "--" are rewritten.
+func bundledArgs(info *setInfo, args []string) []string {
+	var nargs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return append(nargs, args[i:]...)
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if v := info.lookup(name); v != nil {
+			nargs = append(nargs, arg)
+			if !hasValue && !v.IsBoolFlag() && i+1 < len(args) {
+				i++
+				nargs = append(nargs, args[i])
+			}
+			continue
+		}
+		if arg[1] == '-' || hasValue || !isBundle(info, name) {
+			nargs = append(nargs, arg)
+			continue
+		}
+		for _, c := range name {
+			nargs = append(nargs, "-"+string(c))
+		}
+		if !info.lookup(name[len(name)-1:]).IsBoolFlag() && i+1 < len(args) {
+			i++
+			nargs = append(nargs, args[i])
+		}
+	}
+	return nargs
+}
+
+// isBundle reports whether each character of name is a single character flag
+// known to info and all but the last are boolean flags.
+func isBundle(info *setInfo, name string) bool {
+	if len(name) < 2 {
+		return false
+	}
+	for x, c := range name {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+		v := info.lookup(string(c))
+		if v == nil || (x < len(name)-1 && !v.IsBoolFlag()) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowUnknownFlags returns a ParseOption that removes the flags that are not
+// registered from the command line rather than failing.  The removed flags,
+// and their values, are stored in *unknown so they may be passed on to
+// another program, such as a plugin.  *unknown is set to nil if there are no
+// unknown flags.  An unknown flag without an attached value, such as "--name"
+// rather than "--name=value", is presumed to take the following argument as
+// its value unless that argument starts with a dash.  Only the flags
+// preceding the first non-flag argument or "--" are considered.
+func AllowUnknownFlags(unknown *[]string) ParseOption {
+	return func(c *parseConfig) {
+		c.unknown = unknown
+	}
+}
+
+// unknownArgs returns args with the flags unknown to info removed.  The
+// removed flags, and their values, are returned as unknown.
+func unknownArgs(info *setInfo, args []string) (known, unknown []string) {
+	lookup, _ := info.set.(interface{ Lookup(string) *flag.Flag })
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return append(known, args[i:]...), unknown
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		takesValue := false
+		isKnown := name == "h" || name == "help"
+		if v := info.lookup(name); v != nil {
+			isKnown = true
+			takesValue = !v.IsBoolFlag()
+		} else if lookup != nil {
+			if f := lookup.Lookup(name); f != nil {
+				isKnown = true
+				takesValue = !isBoolValue(f.Value)
+			}
+		}
+		next := ""
+		if !hasValue && i+1 < len(args) {
+			next = args[i+1]
+		}
+		switch {
+		case isKnown:
+			known = append(known, arg)
+			if takesValue && !hasValue && i+1 < len(args) {
+				known = append(known, next)
+				i++
+			}
+		case next != "" && next[0] != '-':
+			unknown = append(unknown, arg, next)
+			i++
+		default:
+			unknown = append(unknown, arg)
+		}
+	}
+	return known, unknown
+}
+
+// checkDashes returns an error if any of the options in args are long names
+// introduced by a single dash.  Options that take a value and do not have an
+// attached value consume the following argument.
+func checkDashes(info *setInfo, args []string) error {
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return nil
+		}
+		dashes := "-"
+		if arg[1] == '-' {
+			dashes = "--"
+		}
+		name, _, hasValue := strings.Cut(arg[len(dashes):], "=")
+		if dashes == "-" && len(name) > 1 {
+			return fmt.Errorf("use --%s, not -%s", name, name)
+		}
+		if v := info.lookup(name); v != nil && !hasValue && !v.IsBoolFlag() && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	return nil
+}
+
+// checkArgs returns an error naming the unexpected arguments in rest if c
+// requires strict arguments.
+func (c *parseConfig) checkArgs(rest []string) error {
+	if !c.strictArgs || len(rest) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))
+}
+
+// preParse calls the PreParse functions in c with opts.  The origins of the
+// options set by a Source are recorded with the set described by c.info.
+func (c *parseConfig) preParse(opts any) error {
+	if c.info != nil && len(c.preParsers) > 0 {
+		defer applying(opts, c.info)()
+	}
+	for _, fn := range c.preParsers {
+		if err := fn(opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A setInfo is the information this package maintains about a FlagSet that
+// options have been registered with.  It is kept by the flagValues registered
+// with the set and found through the set's VisitAll method, see
+// lookupSetInfo.
+type setInfo struct {
+	set      FlagSet
+	values   []*flagValue  // the values registered with the set
+	args     []*positional // the positional arguments registered with the set
+	warnings []string      // warnings from the most recent parse
+
+	mu     sync.Mutex // protects frozen
+	frozen bool       // no further options may be registered
+
+	// flagCounts are the {flag-count} fields of the options registered
+	// with the set.
+	flagCounts []reflect.Value
+
+	// profile is the --profile option declared by Profiles, if any.
+	profile *profileValue
+}
+
+// Warnings returns the warnings generated by the most recent parse of set by
+// this package, such as the use of a deprecated flag.  Warnings are also
+// written to the output of set.
+func Warnings(set FlagSet) []string {
+	if info := lookupSetInfo(set); info != nil {
+		return info.warnings
+	}
+	return nil
+}
+
+// warn records the warning msg and writes it to the output of the set.
+func (info *setInfo) warn(msg string) {
+	info.warnings = append(info.warnings, msg)
+	fmt.Fprintln(setOutput(info.set), msg)
+}
+
+// setOutput returns the writer that set writes its errors to.
+func setOutput(set FlagSet) io.Writer {
+	if output != nil {
+		return output
+	}
+	if o, ok := set.(interface{ Output() io.Writer }); ok {
+		return o.Output()
+	}
+	return os.Stderr
+}
+
+// errFrozen is returned when registering options with a frozen FlagSet.
+var errFrozen = errors.New("flag set is frozen")
+
+// Freeze prevents any further options from being registered with set.
+// Subsequent calls to RegisterSet with set return an error and calls to
+// Register with a frozen CommandLine panic.  Freeze is useful for catching
+// options that are registered too late, such as by a plugin initialized after
+// the command line has been parsed.  Freeze has no effect if no options have
+// been registered with set.
+func Freeze(set FlagSet) {
+	if info := lookupSetInfo(set); info != nil {
+		info.mu.Lock()
+		info.frozen = true
+		info.mu.Unlock()
+	}
+}
+
+// isFrozen reports whether Freeze has been called on the set described by
+// info.
+func (info *setInfo) isFrozen() bool {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.frozen
+}
+
+// WasSet reports whether the option named name, as with Lookup, registered
+// with set was set on the command line by the most recent parse of set.
+// Unlike comparing the option to its default value, WasSet reports true when
+// an option is explicitly set to its default value.
+func WasSet(set FlagSet, name string) bool {
+	if v := lookupValue(set, name); v != nil {
+		return v.seen
+	}
+	return false
+}
+
+// Reset restores each option registered with set to the value it had when it
+// was registered, including any {default}.  The elements of slices and maps
+// are restored, not just the slices and maps themselves.  Reset does nothing
+// if no options have been registered with set.
+func Reset(set FlagSet) {
+	info := lookupSetInfo(set)
+	if info == nil {
+		return
+	}
+	for _, v := range info.values {
+		if v.value.IsValid() {
+			v.value.Set(copyValue(v.def))
+			v.origin = ""
+		}
+	}
+}
+
+// copyValue returns a copy of v.  Slices and maps are copied rather than
+// shared with v.
+func copyValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	switch {
+	case v.Kind() == reflect.Slice && !v.IsNil():
+		c.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		reflect.Copy(c, v)
+	case v.Kind() == reflect.Map && !v.IsNil():
+		c.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+		for iter := v.MapRange(); iter.Next(); {
+			c.SetMapIndex(iter.Key(), iter.Value())
+		}
+	default:
+		c.Set(v)
+	}
+	return c
+}
+
+// setFlagCounts sets the {flag-count} fields registered with info to the
+// number of flags set by the most recent parse.
+func (info *setInfo) setFlagCounts() {
+	if len(info.flagCounts) == 0 {
+		return
+	}
+	n := 0
+	if set, ok := info.set.(interface{ Visit(func(*flag.Flag)) }); ok {
+		set.Visit(func(*flag.Flag) { n++ })
+	} else {
+		for _, v := range info.values {
+			if v.seen {
+				n++
+			}
+		}
+	}
+	for _, count := range info.flagCounts {
+		count.SetInt(int64(n))
+	}
+}
+
+// lookup returns the value registered with info for the flag name, or nil.
+func (info *setInfo) lookup(name string) *flagValue {
+	for _, v := range info.values {
+		if v.name == name || (v.short != "" && v.short == name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// lookupSetInfo returns the setInfo for set, as kept by the options
+// registered with set, or nil if no options have been registered with set or
+// set does not have a VisitAll method, as *flag.FlagSet does.
+func lookupSetInfo(set FlagSet) *setInfo {
+	visit, ok := set.(interface{ VisitAll(func(*flag.Flag)) })
+	if !ok {
+		return nil
+	}
+	var info *setInfo
+	visit.VisitAll(func(f *flag.Flag) {
+		if v, ok := f.Value.(*flagValue); ok && info == nil {
+			info = v.info
+		}
+	})
+	return info
+}
+
+// lookupValue returns the value registered with set for the flag name, or nil
+// if name was not registered by this package or set does not have a Lookup
+// method, as *flag.FlagSet does.
+func lookupValue(set FlagSet, name string) *flagValue {
+	lookup, ok := set.(interface{ Lookup(string) *flag.Flag })
+	if !ok {
+		return nil
+	}
+	if f := lookup.Lookup(name); f != nil {
+		v, _ := f.Value.(*flagValue)
+		return v
+	}
+	return nil
+}
+
+// parse calls set.Parse(args) as configured by c, which may be nil.  If
+// parsing failed because a flag registered by this package could not be set,
+// the returned error is a *FieldError.
+func parse(set FlagSet, args []string, c *parseConfig) error {
+	if c == nil {
+		c = &parseConfig{}
+	}
+	info := c.info
+	if info == nil {
+		info = lookupSetInfo(set)
+	}
+	if info == nil {
+		if err := set.Parse(args); err != nil {
+			return err
+		}
+		return c.checkArgs(set.Args())
+	}
+	for _, v := range info.values {
+		v.err = nil
+		v.seen = false
+		if v.origin == OriginFlag {
+			v.origin = ""
+		}
+	}
+	info.warnings = nil
+	if c.profiles != nil {
+		if err := info.setProfiles(c.profiles); err != nil {
+			return err
+		}
+	}
+	if c.windows {
+		args = windowsArgs(info, args)
+	}
+	if c.ignoreCase {
+		if err := checkFoldedNames(info); err != nil {
+			return err
+		}
+		args = foldArgs(info, args)
+	}
+	if c.bundled {
+		args = bundledArgs(info, args)
+	}
+	if c.prefixes {
+		var err error
+		if args, err = prefixArgs(info, args, c.ignoreCase); err != nil {
+			return err
+		}
+	}
+	args = countArgs(info, args)
+	if c.unknown != nil {
+		args, *c.unknown = unknownArgs(info, args)
+	}
+	if c.strictDashes {
+		if err := checkDashes(info, args); err != nil {
+			return err
+		}
+	}
+	if err := set.Parse(args); err != nil {
+		for _, v := range info.values {
+			if v.err != nil {
+				return v.err
+			}
+		}
+		return err
+	}
+	info.setFlagCounts()
+	for _, v := range info.values {
+		if v.envErr != nil && !v.seen {
+			return v.envErr
+		}
+	}
+	if err := checkRequired(info.values); err != nil {
+		return err
+	}
+	if err := checkTogether(info.values); err != nil {
+		return err
+	}
+	rest, err := setArgs(info.args, set.Args())
+	if err != nil {
+		return err
+	}
+	return c.checkArgs(rest)
+}
@@ -0,0 +1,780 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pborman/check"
+)
+
+func TestFieldError(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	opts := &struct {
+		Name  string `flag:"--name=NAME the name"`
+		Count int    `flag:"--count=N the count"`
+	}{}
+	_, err := SubRegisterAndParse(opts, []string{"c", "--name", "bob", "--count", "many"})
+	if err == nil {
+		t.Fatal("did not get an error")
+	}
+	want := `invalid value "many" for flag -count: parse error`
+	if err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("%v is not a FieldError", err)
+	}
+	if fe.Field != "Count" {
+		t.Errorf("got field %q, want %q", fe.Field, "Count")
+	}
+	if fe.Flag != "count" {
+		t.Errorf("got flag %q, want %q", fe.Flag, "count")
+	}
+	if fe.Value != "many" {
+		t.Errorf("got value %q, want %q", fe.Value, "many")
+	}
+	if !errors.Is(err, errParse) {
+		t.Errorf("%v does not wrap %v", err, errParse)
+	}
+
+	// Errors not caused by setting a value are not FieldErrors.
+	_, err = SubRegisterAndParse(opts, []string{"c", "--bogus"})
+	if err == nil || errors.As(err, &fe) {
+		t.Errorf("got error %v, want a non-FieldError", err)
+	}
+}
+
+func TestPreParse(t *testing.T) {
+	type options struct {
+		Name  string `flag:"--name=NAME the name"`
+		Count int    `flag:"--count=N the count"`
+	}
+	setDefaults := PreParse(func(i any) error {
+		opts := i.(*options)
+		opts.Name = "config-name"
+		opts.Count = 3
+		return nil
+	})
+	var opts options
+	if _, err := SubRegisterAndParse(&opts, []string{"c", "--name", "bob"}, setDefaults); err != nil {
+		t.Fatal(err)
+	}
+	want := options{Name: "bob", Count: 3}
+	if opts != want {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+
+	failing := PreParse(func(any) error { return errors.New("no config") })
+	opts = options{}
+	_, err := SubRegisterAndParse(&opts, []string{"c", "--name", "bob"}, failing)
+	if err == nil || err.Error() != "no config" {
+		t.Errorf("got error %v, want no config", err)
+	}
+	if opts.Name != "" {
+		t.Errorf("arguments parsed after PreParse failed")
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	set := NewFlagSet("")
+	if err := RegisterSet("", &struct{ Name string }{}, set); err != nil {
+		t.Fatal(err)
+	}
+	Freeze(set)
+	err := RegisterSet("", &struct{ Late string }{}, set)
+	if err == nil || err.Error() != "flag set is frozen" {
+		t.Errorf("got error %v, want flag set is frozen", err)
+	}
+	if err := set.Parse([]string{"--name", "bob"}); err != nil {
+		t.Errorf("parsing frozen set: %v", err)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	var out bytes.Buffer
+	output = &out
+	defer func() { output = nil }()
+	opts := &struct {
+		OldName string `flag:"--old-name {deprecated=--name} the old name"`
+		Name    string `flag:"--name the name"`
+		Q       bool   `flag:"-q {deprecated} be quiet"`
+	}{}
+	set := NewFlagSet("")
+	if err := RegisterSet("", opts, set); err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(set, []string{"--old-name", "bob", "-q"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"flag --old-name is deprecated, use --name instead",
+		"flag -q is deprecated",
+	}
+	if got := Warnings(set); !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings %q, want %q", got, want)
+	}
+	if got := out.String(); got != strings.Join(want, "\n")+"\n" {
+		t.Errorf("got output %q", got)
+	}
+	if opts.OldName != "bob" {
+		t.Errorf("got old name %q, want bob", opts.OldName)
+	}
+	if err := parse(set, []string{"--name", "fred"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := Warnings(set); got != nil {
+		t.Errorf("got warnings %q, want none", got)
+	}
+
+	// Deprecated flags are marked in Help and omitted from the usage line.
+	if got, want := UsageLine("c", "", opts), "c [--name=VALUE]"; got != want {
+		t.Errorf("got usage line %q, want %q", got, want)
+	}
+	var help bytes.Buffer
+	Help(&help, "c", "", opts)
+	want = []string{
+		"--old-name=VALUE    the old name (deprecated)",
+		" -q                 be quiet (deprecated)",
+	}
+	for _, w := range want {
+		if !strings.Contains(help.String(), w) {
+			t.Errorf("help does not contain %q:\n%s", w, &help)
+		}
+	}
+}
+
+func TestStrictArgs(t *testing.T) {
+	for _, tt := range []struct {
+		opts any
+		args []string
+		err  string
+	}{{
+		opts: &struct{ V bool }{},
+		args: []string{"c", "-v"},
+	}, {
+		opts: &struct{ V bool }{},
+		args: []string{"c", "-v", "a", "b"},
+		err:  "unexpected arguments: a b",
+	}, {
+		opts: &struct {
+			Src string `arg:"SRC"`
+		}{},
+		args: []string{"c", "a"},
+	}, {
+		opts: &struct {
+			Src string `arg:"SRC"`
+		}{},
+		args: []string{"c", "a", "b"},
+		err:  "unexpected arguments: b",
+	}} {
+		_, err := SubRegisterAndParse(tt.opts, tt.args, StrictArgs())
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+		}
+	}
+	// Without StrictArgs extra arguments are returned.
+	args, err := SubRegisterAndParse(&struct{ V bool }{}, []string{"c", "a"})
+	if err != nil || !reflect.DeepEqual(args, []string{"a"}) {
+		t.Errorf("got %q, %v, want [a]", args, err)
+	}
+}
+
+func TestWindowsStyle(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Name    string `flag:"--name=NAME the name"`
+		Verbose bool   `flag:"--verbose be verbose"`
+		Count   int    `flag:"--count=N the count"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want options
+		rest []string
+		err  string
+	}{{
+		args: []string{"c", "/name:bob", "/verbose"},
+		want: options{Name: "bob", Verbose: true},
+	}, {
+		args: []string{"c", "/name:a:b", "--count=3", "/tmp/file"},
+		want: options{Name: "a:b", Count: 3},
+		rest: []string{"/tmp/file"},
+	}, {
+		args: []string{"c", "/verbose", "--", "/name:bob"},
+		want: options{Verbose: true},
+		rest: []string{"/name:bob"},
+	}, {
+		args: []string{"c", "/count:many"},
+		err:  `invalid value "many" for flag -count`,
+	}} {
+		var opts options
+		rest, err := SubRegisterAndParse(&opts, tt.args, WindowsStyle())
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if opts != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.args, opts, tt.want)
+		}
+		if len(rest) != len(tt.rest) || (len(rest) > 0 && !reflect.DeepEqual(rest, tt.rest)) {
+			t.Errorf("%q: got rest %q, want %q", tt.args, rest, tt.rest)
+		}
+	}
+
+	// Without WindowsStyle the arguments are not flags.
+	var opts options
+	rest, err := SubRegisterAndParse(&opts, []string{"c", "/verbose"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Verbose || !reflect.DeepEqual(rest, []string{"/verbose"}) {
+		t.Errorf("got verbose %v and rest %q", opts.Verbose, rest)
+	}
+}
+
+func TestIgnoreCase(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Name    string        `flag:"--name=NAME the name"`
+		Timeout time.Duration `flag:"--timeout=DURATION the timeout"`
+		Verbose bool          `flag:"--verbose be verbose"`
+		V       bool          `flag:"-v be very verbose"`
+		BigV    bool          `flag:"-V print the version"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want options
+		rest []string
+		err  string
+	}{{
+		args: []string{"c", "--Verbose", "--TIMEOUT", "1s", "--Name=bob"},
+		want: options{Name: "bob", Timeout: time.Second, Verbose: true},
+	}, {
+		args: []string{"c", "-V", "--NAME", "--Verbose", "file", "--Verbose"},
+		want: options{Name: "--Verbose", BigV: true},
+		rest: []string{"file", "--Verbose"},
+	}, {
+		args: []string{"c", "--verbosity"},
+		err:  "flag provided but not defined: -verbosity",
+	}} {
+		var opts options
+		rest, err := SubRegisterAndParse(&opts, tt.args, IgnoreCase())
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if opts != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.args, opts, tt.want)
+		}
+		if strings.Join(rest, " ") != strings.Join(tt.rest, " ") {
+			t.Errorf("%q: got args %q, want %q", tt.args, rest, tt.rest)
+		}
+	}
+
+	var help bytes.Buffer
+	Help(&help, "c", "", &options{})
+	if !strings.Contains(help.String(), "--timeout=DURATION") {
+		t.Errorf("unexpected help:\n%s", &help)
+	}
+
+	var bad struct {
+		Name  string `flag:"--name=NAME the name"`
+		Name2 string `flag:"--Name=NAME another name"`
+	}
+	_, err := SubRegisterAndParse(&bad, []string{"c"}, IgnoreCase())
+	if s := check.Error(err, "flag --Name conflicts with --name when case is ignored"); s != "" {
+		t.Error(s)
+	}
+	// The names are distinct when case is not ignored.
+	if _, err := SubRegisterAndParse(&bad, []string{"c", "--Name=x"}); err != nil || bad.Name2 != "x" {
+		t.Errorf("got %v and %+v, want --Name set", err, bad)
+	}
+	if _, err := SubRegisterAndParse(&options{}, []string{"c", "--Name=x"}); err == nil {
+		t.Errorf("--Name matched --name when case is not ignored")
+	}
+}
+
+func TestAllowPrefixes(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Timeout time.Duration `flag:"--timeout=DURATION the timeout"`
+		Verbose bool          `flag:"--verbose be verbose"`
+		Version bool          `flag:"--version print the version"`
+		Vers    string        `flag:"--vers=V the vers"`
+		T       bool          `flag:"-t terse"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want options
+		err  string
+	}{{
+		args: []string{"c", "--tim", "1s", "--verb"},
+		want: options{Timeout: time.Second, Verbose: true},
+	}, {
+		args: []string{"c", "--timeout=2s", "--versi", "--vers", "x"},
+		want: options{Timeout: 2 * time.Second, Version: true, Vers: "x"},
+	}, {
+		args: []string{"c", "--ti=3s"},
+		want: options{Timeout: 3 * time.Second},
+	}, {
+		args: []string{"c", "--ve"},
+		err:  "ambiguous flag --ve matches --verbose, --vers, --version",
+	}, {
+		// Single dash flags are not matched by prefix.
+		args: []string{"c", "-tim", "1s"},
+		err:  "flag provided but not defined: -tim",
+	}, {
+		args: []string{"c", "--x"},
+		err:  "flag provided but not defined: -x",
+	}} {
+		var opts options
+		_, err := SubRegisterAndParse(&opts, tt.args, AllowPrefixes())
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if opts != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.args, opts, tt.want)
+		}
+	}
+
+	// Without AllowPrefixes a prefix is not a flag.
+	var opts options
+	if _, err := SubRegisterAndParse(&opts, []string{"c", "--tim", "1s"}); err == nil {
+		t.Errorf("did not get an error for a prefix")
+	}
+}
+
+func TestBundledShorts(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		A    bool   `flag:"-a all"`
+		B    bool   `flag:"-b brief"`
+		C    bool   `flag:"--color -c use color"`
+		F    string `flag:"-f=FILE the file"`
+		V    int    `flag:"-v {count} verbosity"`
+		Abc  bool   `flag:"--abc the abc flag"`
+		Long bool   `flag:"--long use the long format"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want options
+		rest []string
+		err  string
+	}{{
+		args: []string{"c", "-ab", "-c"},
+		want: options{A: true, B: true, C: true},
+	}, {
+		args: []string{"c", "-abf", "file", "rest"},
+		want: options{A: true, B: true, F: "file"},
+		rest: []string{"rest"},
+	}, {
+		args: []string{"c", "-vav", "-vv"},
+		want: options{A: true, V: 4},
+	}, {
+		// A flag named by the argument is not unbundled.
+		args: []string{"c", "-abc"},
+		want: options{Abc: true},
+	}, {
+		args: []string{"c", "-f", "-ab", "--long"},
+		want: options{F: "-ab", Long: true},
+	}, {
+		args: []string{"c", "-ba", "--", "-ab"},
+		want: options{A: true, B: true},
+		rest: []string{"-ab"},
+	}, {
+		args: []string{"c", "-afb"},
+		err:  "flag provided but not defined: -afb",
+	}, {
+		args: []string{"c", "-ax"},
+		err:  "flag provided but not defined: -ax",
+	}, {
+		args: []string{"c", "--ab"},
+		err:  "flag provided but not defined: -ab",
+	}} {
+		var opts options
+		rest, err := SubRegisterAndParse(&opts, tt.args, BundledShorts())
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if opts != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.args, opts, tt.want)
+		}
+		if strings.Join(rest, " ") != strings.Join(tt.rest, " ") {
+			t.Errorf("%q: got args %q, want %q", tt.args, rest, tt.rest)
+		}
+	}
+}
+
+func TestStrictDashes(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Name    string `flag:"--name=NAME the name"`
+		N       int    `flag:"-n=N the count"`
+		Verbose bool   `flag:"--verbose be verbose"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want options
+		err  string
+	}{{
+		args: []string{"c", "--name", "bob", "-n", "3", "--verbose"},
+		want: options{Name: "bob", N: 3, Verbose: true},
+	}, {
+		args: []string{"c", "--name=bob", "-n=3"},
+		want: options{Name: "bob", N: 3},
+	}, {
+		// The value of --name is not an option.
+		args: []string{"c", "--name", "-bob"},
+		want: options{Name: "-bob"},
+	}, {
+		args: []string{"c", "--verbose", "file", "-name"},
+		want: options{Verbose: true},
+	}, {
+		args: []string{"c", "-name", "bob"},
+		err:  "use --name, not -name",
+	}, {
+		args: []string{"c", "-n", "3", "-verbose"},
+		err:  "use --verbose, not -verbose",
+	}, {
+		args: []string{"c", "-name=bob"},
+		err:  "use --name, not -name",
+	}} {
+		var opts options
+		_, err := SubRegisterAndParse(&opts, tt.args, StrictDashes())
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if opts != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.args, opts, tt.want)
+		}
+	}
+
+	// Without StrictDashes -name is accepted.
+	var opts options
+	if _, err := SubRegisterAndParse(&opts, []string{"c", "-name", "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Name != "bob" {
+		t.Errorf("got name %q, want bob", opts.Name)
+	}
+}
+
+func TestAllowUnknownFlags(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Name    string `flag:"--name=NAME the name"`
+		Verbose bool   `flag:"-v be verbose"`
+	}
+	for _, tt := range []struct {
+		args    []string
+		want    options
+		unknown []string
+		rest    []string
+	}{{
+		args: []string{"--name", "bob", "-v", "file"},
+		want: options{Name: "bob", Verbose: true},
+		rest: []string{"file"},
+	}, {
+		args:    []string{"--plugin-dir", "/tmp", "--name", "bob", "--plugin-debug", "-v", "--plugin-level=3", "file"},
+		want:    options{Name: "bob", Verbose: true},
+		unknown: []string{"--plugin-dir", "/tmp", "--plugin-debug", "--plugin-level=3"},
+		rest:    []string{"file"},
+	}, {
+		// The value of a known flag is not mistaken for an unknown flag.
+		args:    []string{"--name", "--x", "-y", "--", "-z"},
+		want:    options{Name: "--x"},
+		unknown: []string{"-y"},
+		rest:    []string{"-z"},
+	}} {
+		var opts options
+		unknown := []string{"stale"}
+		rest, err := SubRegisterAndParse(&opts, append([]string{"c"}, tt.args...), AllowUnknownFlags(&unknown))
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if opts != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.args, opts, tt.want)
+		}
+		if !reflect.DeepEqual(unknown, tt.unknown) {
+			t.Errorf("%q: got unknown %q, want %q", tt.args, unknown, tt.unknown)
+		}
+		if strings.Join(rest, " ") != strings.Join(tt.rest, " ") {
+			t.Errorf("%q: got args %q, want %q", tt.args, rest, tt.rest)
+		}
+	}
+
+	// Without AllowUnknownFlags an unknown flag is an error.
+	var opts options
+	if _, err := SubRegisterAndParse(&opts, []string{"c", "--plugin-dir", "/tmp"}); err == nil {
+		t.Errorf("did not get an error for an unknown flag")
+	}
+}
+
+func TestRequired(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Name  string `flag:"--name=NAME {required} the name"`
+		Count int    `flag:"--count=N {required} the count"`
+		V     bool   `flag:"-v {required} be verbose"`
+		Other string `flag:"--other=VALUE not required"`
+	}
+	for _, tt := range []struct {
+		args []string
+		err  string
+	}{
+		{args: []string{"c"}, err: "missing required flags --name, --count, -v"},
+		{args: []string{"c", "--name", "bob", "--other", "x"}, err: "missing required flags --count, -v"},
+		{args: []string{"c", "--name", "bob", "-v"}, err: "missing required flag --count"},
+		// Zero values are still set.
+		{args: []string{"c", "--name=", "--count=0", "-v=false"}},
+	} {
+		_, err := SubRegisterAndParse(&options{}, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+		}
+	}
+
+	// Values set by the previous parse of the same options are not
+	// considered set.
+	var opts options
+	if _, err := SubRegisterAndParse(&opts, []string{"c", "--name=a", "--count=1", "-v"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := SubRegisterAndParse(&opts, []string{"c", "--name=a", "--count=1"})
+	if s := check.Error(err, "missing required flag -v"); s != "" {
+		t.Error(s)
+	}
+
+	// The environment satisfies a required flag.
+	t.Setenv("TEST_REQUIRED_NAME", "env")
+	_, err = SubRegisterAndParse(&struct {
+		Name string `flag:"--name=NAME {required} {env=TEST_REQUIRED_NAME} the name"`
+	}{}, []string{"c"})
+	if err != nil {
+		t.Errorf("name from environment: %v", err)
+	}
+}
+
+func TestTogether(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		User     string `flag:"--username=NAME {together=auth} the user"`
+		Password string `flag:"--password=PASSWORD {together=auth} the password"`
+		Token    string `flag:"--token=TOKEN {together=auth} the token"`
+		Host     string `flag:"--host=HOST {together=server} the host"`
+		Port     int    `flag:"--port=PORT {together=server} the port"`
+	}
+	for _, tt := range []struct {
+		args []string
+		err  string
+	}{
+		{args: []string{"c"}},
+		{args: []string{"c", "--username=bob", "--password=x", "--token=t"}},
+		{args: []string{"c", "--host=h", "--port=0"}},
+		{args: []string{"c", "--username=bob", "--token=t"}, err: "missing flag --password of group auth"},
+		{args: []string{"c", "--password=x"}, err: "missing flags --username, --token of group auth"},
+		{args: []string{"c", "--port=80"}, err: "missing flag --host of group server"},
+	} {
+		_, err := SubRegisterAndParse(&options{}, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+		}
+	}
+
+	_, err := SubRegisterAndParse(&struct {
+		User string `flag:"--username=NAME {together} the user"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{together} requires a group name: username"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestWasSet(t *testing.T) {
+	type options struct {
+		Timeout time.Duration `flag:"--timeout=DURATION the timeout"`
+		Name    string        `flag:"--name=NAME the name"`
+		V       bool          `flag:"-v be verbose"`
+	}
+	opts := &options{Timeout: time.Second}
+	set := NewFlagSet("")
+	set.SetOutput(io.Discard)
+	if err := RegisterSet("", opts, set); err != nil {
+		t.Fatal(err)
+	}
+	if WasSet(set, "timeout") {
+		t.Errorf("timeout set before parsing")
+	}
+	if err := parse(set, []string{"--timeout", "1s", "-v"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"timeout": true,
+		"name":    false,
+		"v":       true,
+		"missing": false,
+	} {
+		if got := WasSet(set, name); got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+
+	// Only the most recent parse is considered.
+	if err := parse(set, []string{"--name", "bob"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if WasSet(set, "timeout") || !WasSet(set, "name") {
+		t.Errorf("got timeout %v and name %v, want false and true", WasSet(set, "timeout"), WasSet(set, "name"))
+	}
+
+	// The same options registered with another set are reported
+	// separately.
+	other := NewFlagSet("")
+	other.SetOutput(io.Discard)
+	if err := RegisterSet("", opts, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(other, []string{"--timeout", "2s"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !WasSet(other, "timeout") || WasSet(other, "name") {
+		t.Errorf("got timeout %v and name %v in other, want true and false", WasSet(other, "timeout"), WasSet(other, "name"))
+	}
+	if WasSet(set, "timeout") || !WasSet(set, "name") {
+		t.Errorf("parsing other changed set")
+	}
+	if WasSet(NewFlagSet(""), "name") {
+		t.Errorf("name set in an unregistered set")
+	}
+}
+
+func TestReset(t *testing.T) {
+	type options struct {
+		Name    string            `flag:"--name=NAME the name"`
+		Level   int               `flag:"--level=N {default=3} the level"`
+		Tags    []string          `flag:"--tag=TAG a tag"`
+		Labels  map[string]string `flag:"--label=KEY=VALUE a label"`
+		Ignored string            `flag:"-"`
+	}
+	opts := &options{
+		Name:   "bob",
+		Tags:   []string{"a", "b"},
+		Labels: map[string]string{"env": "prod"},
+	}
+	set := NewFlagSet("")
+	if err := RegisterSet("c", opts, set); err != nil {
+		t.Fatal(err)
+	}
+	want := options{
+		Name:   "bob",
+		Level:  3,
+		Tags:   []string{"a", "b"},
+		Labels: map[string]string{"env": "prod"},
+	}
+	if err := set.Parse([]string{"--name=fred", "--level=5", "--tag=c", "--label=env=dev"}); err != nil {
+		t.Fatal(err)
+	}
+	opts.Tags[0] = "x"
+	opts.Ignored = "ignored"
+	Reset(set)
+	want.Ignored = "ignored"
+	if !reflect.DeepEqual(*opts, want) {
+		t.Errorf("got %+v, want %+v", *opts, want)
+	}
+
+	// The options can be parsed again from their defaults.
+	if err := set.Parse([]string{"--tag=c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := opts.Tags, []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Options registered with other sets are not changed.
+	other := &options{Name: "other"}
+	if err := RegisterSet("c", other, NewFlagSet("")); err != nil {
+		t.Fatal(err)
+	}
+	other.Name = "changed"
+	Reset(set)
+	Reset(NewFlagSet(""))
+	if other.Name != "changed" {
+		t.Errorf("options registered with another set were reset")
+	}
+}
+
+func TestFlagCount(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Name  string `flag:"--name=NAME the name"`
+		Count int    `flag:"--count=N the count"`
+		V     bool   `flag:"-v be verbose"`
+		Flags int    `flag:"{flag-count}"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"c"}, 0},
+		{[]string{"c", "file"}, 0},
+		{[]string{"c", "--name=bob", "--count", "1", "-v", "file"}, 3},
+		{[]string{"c", "--name=bob", "--name=fred"}, 1},
+	} {
+		opts := &options{Flags: -1}
+		if _, err := SubRegisterAndParse(opts, tt.args); err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if opts.Flags != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.args, opts.Flags, tt.want)
+		}
+	}
+
+	if Lookup(&options{}, "flags") != nil {
+		t.Errorf("{flag-count} declared an option")
+	}
+	_, err := SubRegisterAndParse(&options{}, []string{"c", "--flags=1"})
+	if s := check.Error(err, "flag provided but not defined: -flags"); s != "" {
+		t.Error(s)
+	}
+	_, err = SubRegisterAndParse(&struct {
+		Flags string `flag:"{flag-count}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{flag-count} requires an int, not string"); s != "" {
+		t.Error(s)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A positional is a positional argument declared by a field with an arg tag.
+// The syntax of an arg tag is:
+//
+//	NAME [description]       a required argument
+//	[NAME] [description]     an optional argument
+//	NAME... [description]    one or more remaining arguments
+//	[NAME...] [description]  zero or more remaining arguments
+//
+// The remaining arguments must be collected by a slice field.
+type positional struct {
+	name     string        // name of the argument, e.g., SRC
+	field    string        // name of the field
+	help     string        // description of the argument
+	optional bool          // the argument may be omitted
+	rest     bool          // the argument collects the remaining arguments
+	value    reflect.Value // the field's value
+}
+
+// isArg reports whether sf declares a positional argument rather than an
+// option.
+func isArg(sf reflect.StructField) bool {
+	_, ok := sf.Tag.Lookup("arg")
+	return ok
+}
+
+// synopsis returns the synopsis of p, e.g., "[DST]".
+func (p *positional) synopsis() string {
+	s := p.name
+	if p.rest {
+		s += "..."
+	}
+	if p.optional {
+		s = synopsisOpen + s + synopsisClose
+	}
+	return s
+}
+
+// positionals returns the positional arguments declared by i.  An error is
+// returned if i is not a pointer to a struct or has an invalid arg tag.
+func positionals(i any) ([]*positional, error) {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T is not a pointer to a struct", i)
+	}
+	var args []*positional
+	err := walkFields(v.Elem(), "", func(sf reflect.StructField, fv reflect.Value, _ string) error {
+		if !isArg(sf) || !fv.CanSet() {
+			return nil
+		}
+		tag := strings.TrimSpace(sf.Tag.Get("arg"))
+		name, help, _ := strings.Cut(tag, " ")
+		p := &positional{
+			field: sf.Name,
+			help:  strings.TrimSpace(help),
+			value: fv,
+		}
+		if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+			p.optional = true
+			name = name[1 : len(name)-1]
+		}
+		if strings.HasSuffix(name, "...") {
+			p.rest = true
+			name = strings.TrimSuffix(name, "...")
+		}
+		if name == "" || strings.ContainsAny(name, "[]") {
+			return fmt.Errorf("arg tag has invalid name: %q", tag)
+		}
+		p.name = name
+		if p.rest && fv.Kind() != reflect.Slice {
+			return fmt.Errorf("arg %s must be a slice, not %v", name, fv.Type())
+		}
+		if len(args) > 0 {
+			switch prev := args[len(args)-1]; {
+			case prev.rest:
+				return fmt.Errorf("arg %s follows remaining arguments %s", name, prev.name)
+			case prev.optional && !p.optional:
+				return fmt.Errorf("required arg %s follows optional arg %s", name, prev.name)
+			}
+		}
+		if _, err := newValue(&optTag{}, fv.Addr().Interface()); err != nil {
+			return err
+		}
+		args = append(args, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// argSynopsis returns the synopsis of the positional arguments declared by i,
+// e.g., "SRC [DST] [EXTRA...]".
+func argSynopsis(i any) string {
+	args, err := positionals(i)
+	if err != nil {
+		return ""
+	}
+	parts := make([]string, len(args))
+	for x, p := range args {
+		parts[x] = p.synopsis()
+	}
+	return strings.Join(parts, " ")
+}
+
+// setArgs sets the positional arguments in pargs from args and returns the
+// arguments not claimed by pargs.  An error is returned if a required
+// argument is missing or a value is invalid.
+func setArgs(pargs []*positional, args []string) ([]string, error) {
+	for _, p := range pargs {
+		if len(args) == 0 {
+			if p.optional {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("missing required argument %s", p.name)
+		}
+		value, err := newValue(&optTag{}, p.value.Addr().Interface())
+		if err != nil {
+			return nil, err
+		}
+		n := 1
+		if p.rest {
+			n = len(args)
+		}
+		for _, arg := range args[:n] {
+			if err := value.Set(arg); err != nil {
+				return nil, fmt.Errorf("invalid value %q for argument %s: %v", arg, p.name, err)
+			}
+		}
+		args = args[n:]
+	}
+	return args, nil
+}
+
+// Arg returns the i'th argument remaining in set after parsing, converted to
+// type T.  T may be any type that may be used for an option, such as an int
+// or a time.Duration.  An error is returned if set does not have an i'th
+// argument or it cannot be converted to T.
+//
+// # Example
+//
+//	set.Parse([]string{"3", "5s"})
+//	n, err := flags.Arg[int](set, 0)
+//	d, err := flags.Arg[time.Duration](set, 1)
+func Arg[T any](set FlagSet, i int) (T, error) {
+	var t T
+	args := set.Args()
+	if i < 0 || i >= len(args) {
+		return t, fmt.Errorf("argument %d out of range: have %d arguments", i, len(args))
+	}
+	value, err := newValue(&optTag{}, &t)
+	if err != nil {
+		return t, err
+	}
+	if err := value.Set(args[i]); err != nil {
+		return t, fmt.Errorf("invalid value %q for argument %d: %v", args[i], i, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pborman/check"
+)
+
+type copyOptions struct {
+	Verbose bool     `flag:"-v be verbose"`
+	Src     string   `arg:"SRC the source"`
+	Dst     string   `arg:"[DST] the destination"`
+	Extra   []string `arg:"[EXTRA...] additional files"`
+}
+
+func TestPositionalUsageLine(t *testing.T) {
+	got := UsageLine("cmd", "", &copyOptions{})
+	want := "cmd [-v] SRC [DST] [EXTRA...]"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSetSynopsisBrackets(t *testing.T) {
+	defer SetSynopsisBrackets("", "")
+	SetSynopsisBrackets("<", ">")
+	got := UsageLine("cmd", "", &copyOptions{})
+	want := "cmd <-v> SRC <DST> <EXTRA...>"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	var out bytes.Buffer
+	Help(&out, "cmd", "", &copyOptions{})
+	if got := out.String(); !strings.HasPrefix(got, "Usage: "+want+"\n") {
+		t.Errorf("got help:\n%s\nwant usage %q", got, want)
+	}
+
+	SetSynopsisBrackets("", "")
+	got = UsageLine("cmd", "", &copyOptions{})
+	want = "cmd [-v] SRC [DST] [EXTRA...]"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPositionals(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want copyOptions
+		err  string
+	}{{
+		args: []string{"c"},
+		err:  "missing required argument SRC",
+	}, {
+		args: []string{"c", "-v", "a"},
+		want: copyOptions{Verbose: true, Src: "a"},
+	}, {
+		args: []string{"c", "a", "b"},
+		want: copyOptions{Src: "a", Dst: "b"},
+	}, {
+		args: []string{"c", "a", "b", "c", "d"},
+		want: copyOptions{Src: "a", Dst: "b", Extra: []string{"c", "d"}},
+	}, {
+		// Arguments are not split at commas.
+		args: []string{"c", "a,b", "b", "c,d.txt", "e"},
+		want: copyOptions{Src: "a,b", Dst: "b", Extra: []string{"c,d.txt", "e"}},
+	}} {
+		var opts copyOptions
+		_, err := SubRegisterAndParse(&opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if !reflect.DeepEqual(opts, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.args, opts, tt.want)
+		}
+	}
+}
+
+func TestPositionalErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts any
+		err  string
+	}{{
+		name: "required after optional",
+		opts: &struct {
+			A string `arg:"[A]"`
+			B string `arg:"B"`
+		}{},
+		err: "required arg B follows optional arg A",
+	}, {
+		name: "after rest",
+		opts: &struct {
+			A []string `arg:"A..."`
+			B string   `arg:"[B]"`
+		}{},
+		err: "arg B follows remaining arguments A",
+	}, {
+		name: "rest not a slice",
+		opts: &struct {
+			A string `arg:"A..."`
+		}{},
+		err: "arg A must be a slice, not string",
+	}, {
+		name: "bad name",
+		opts: &struct {
+			A string `arg:"[]"`
+		}{},
+		err: `arg tag has invalid name: "[]"`,
+	}, {
+		name: "bad value",
+		opts: &struct {
+			N int `arg:"N"`
+		}{},
+		err: `invalid value "x" for argument N: parse error`,
+	}} {
+		_, err := SubRegisterAndParse(tt.opts, []string{"c", "x"})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s: %s", tt.name, s)
+		}
+	}
+}
+
+func TestArg(t *testing.T) {
+	set := NewFlagSet("")
+	if err := set.Parse([]string{"42", "1m30s", "many"}); err != nil {
+		t.Fatal(err)
+	}
+	n, err := Arg[int](set, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 {
+		t.Errorf("got %d, want 42", n)
+	}
+	d, err := Arg[time.Duration](set, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != 90*time.Second {
+		t.Errorf("got %v, want 1m30s", d)
+	}
+
+	_, err = Arg[int](set, 2)
+	if s := check.Error(err, `invalid value "many" for argument 2`); s != "" {
+		t.Error(s)
+	}
+	_, err = Arg[string](set, 3)
+	if s := check.Error(err, "argument 3 out of range"); s != "" {
+		t.Error(s)
+	}
+	_, err = Arg[string](set, -1)
+	if s := check.Error(err, "argument -1 out of range"); s != "" {
+		t.Error(s)
+	}
+}
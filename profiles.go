@@ -0,0 +1,115 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profiles returns a ParseOption that declares a --profile option that sets
+// the options named by the selected profile.  p maps the name of each profile
+// to a map from flag names to the values to set them to, e.g.,
+//
+//	flags.SubRegisterAndParse(opts, args, flags.Profiles(map[string]map[string]string{
+//		"fast": {"workers": "16", "cache": "true"},
+//	}))
+//
+// The options in a profile do not override options set earlier on the
+// command line, so "--workers=4 --profile=fast" and "--profile=fast
+// --workers=4" both set workers to 4.  The --profile option remains declared
+// by the flag set for later parses, which use the profiles they are passed.
+func Profiles(p map[string]map[string]string) ParseOption {
+	return func(c *parseConfig) {
+		c.profiles = p
+	}
+}
+
+// A profileValue is the Value of the --profile option.
+type profileValue struct {
+	info     *setInfo
+	profiles map[string]map[string]string
+	name     string
+}
+
+// setProfiles declares the --profile option for the set described by info
+// with the profiles p.  If the option has already been declared its profiles
+// are replaced by p.
+func (info *setInfo) setProfiles(p map[string]map[string]string) error {
+	if info.profile != nil {
+		info.profile.profiles = p
+		info.profile.name = ""
+		return nil
+	}
+	if v := info.lookup("profile"); v != nil {
+		return fmt.Errorf("--profile conflicts with field %s", v.field)
+	}
+	if lookup, ok := info.set.(interface{ Lookup(string) *flag.Flag }); ok && lookup.Lookup("profile") != nil {
+		return errors.New("--profile is already defined")
+	}
+	pv := &profileValue{info: info, profiles: p}
+	usage := "set the options in profile NAME (" + strings.Join(pv.names(), ", ") + ")"
+	if err := setvar(info.set, pv, "profile", usage); err != nil {
+		return err
+	}
+	info.profile = pv
+	return nil
+}
+
+// names returns the sorted names of the profiles in p.
+func (p *profileValue) names() []string {
+	names := make([]string, 0, len(p.profiles))
+	for name := range p.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *profileValue) String() string {
+	if p == nil {
+		return ""
+	}
+	return p.name
+}
+
+func (p *profileValue) Set(s string) error {
+	profile, ok := p.profiles[s]
+	if !ok {
+		return fmt.Errorf("unknown profile %q (available: %s)", s, strings.Join(p.names(), ", "))
+	}
+	flags := make([]string, 0, len(profile))
+	for flag := range profile {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+	for _, flag := range flags {
+		v := p.info.lookup(flag)
+		if v == nil {
+			return fmt.Errorf("profile %s: unknown flag %s", s, flag)
+		}
+		if v.seen {
+			continue
+		}
+		if err := v.Value.Set(profile[flag]); err != nil {
+			return fmt.Errorf("profile %s: flag %s: %v", s, flag, err)
+		}
+		v.origin = OriginFlag
+	}
+	p.name = s
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"testing"
+
+	"github.com/pborman/check"
+)
+
+func TestProfiles(t *testing.T) {
+	type options struct {
+		Workers int  `flag:"--workers=N number of workers"`
+		Cache   bool `flag:"--cache enable the cache"`
+		Name    string
+	}
+	profiles := map[string]map[string]string{
+		"fast": {"workers": "16", "cache": "true"},
+		"slow": {"workers": "1"},
+		"bad":  {"workers": "many"},
+		"typo": {"worker": "1"},
+	}
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		workers int
+		cache   bool
+		err     string
+	}{{
+		name: "none",
+	}, {
+		name:    "fast",
+		args:    []string{"--profile", "fast"},
+		workers: 16,
+		cache:   true,
+	}, {
+		name:    "override-after",
+		args:    []string{"--profile", "fast", "--workers=4"},
+		workers: 4,
+		cache:   true,
+	}, {
+		name:    "override-before",
+		args:    []string{"--workers=4", "--profile", "fast"},
+		workers: 4,
+		cache:   true,
+	}, {
+		name: "unknown",
+		args: []string{"--profile", "medium"},
+		err:  `unknown profile "medium" (available: bad, fast, slow, typo)`,
+	}, {
+		name: "bad-value",
+		args: []string{"--profile", "bad"},
+		err:  "profile bad: flag workers:",
+	}, {
+		name: "bad-flag",
+		args: []string{"--profile", "typo"},
+		err:  "profile typo: unknown flag worker",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &options{}
+			_, err := SubRegisterAndParse(opts, append([]string{"c"}, tt.args...), Profiles(profiles))
+			if s := check.Error(err, tt.err); s != "" {
+				t.Fatal(s)
+			}
+			if err != nil {
+				return
+			}
+			if opts.Workers != tt.workers {
+				t.Errorf("got workers %d, want %d", opts.Workers, tt.workers)
+			}
+			if opts.Cache != tt.cache {
+				t.Errorf("got cache %v, want %v", opts.Cache, tt.cache)
+			}
+		})
+	}
+}
+
+func TestProfilesParse(t *testing.T) {
+	type options struct {
+		Workers int    `flag:"--workers=N {required} number of workers"`
+		Profile string `flag:"--profile=NAME the profile"`
+	}
+	fast := map[string]map[string]string{"fast": {"workers": "16"}}
+
+	// A profile satisfies {required}.
+	opts := &struct {
+		Workers int `flag:"--workers=N {required} number of workers"`
+	}{}
+	set := NewFlagSet("")
+	if err := RegisterSet("c", opts, set); err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(set, []string{"--profile", "fast"}, newParseConfig([]ParseOption{Profiles(fast)})); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Workers != 16 {
+		t.Errorf("got workers %d, want 16", opts.Workers)
+	}
+
+	// Later parses use the profiles they are passed.
+	slow := map[string]map[string]string{"slow": {"workers": "1"}}
+	if err := parse(set, []string{"--profile", "slow"}, newParseConfig([]ParseOption{Profiles(slow)})); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Workers != 1 {
+		t.Errorf("got workers %d, want 1", opts.Workers)
+	}
+
+	_, err := SubRegisterAndParse(&options{}, []string{"c", "--workers=1"}, Profiles(fast))
+	if s := check.Error(err, "--profile conflicts with field Profile"); s != "" {
+		t.Error(s)
+	}
+}
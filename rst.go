@@ -0,0 +1,65 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"fmt"
+	"io"
+)
+
+// RST writes a description of command and the options declared by opts to w
+// as reStructuredText for use with Sphinx.  The description is a program
+// directive followed by an option directive for each option whose body is
+// the option's help.  As an example:
+//
+//	.. program:: command
+//
+//	.. option:: --alpha=LEVEL
+//
+//	   set the alpha level
+func RST(w io.Writer, command string, opts any) error {
+	descs, err := Describe(opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, ".. program:: %s\n", command)
+	for _, d := range descs {
+		if d.Hidden {
+			continue
+		}
+		name := "--" + d.Name
+		if len(d.Name) == 1 {
+			name = "-" + d.Name
+		}
+		switch {
+		case d.Bool:
+		case d.Optional:
+			name += "[=" + d.Param + "]"
+		case len(d.Name) == 1:
+			// Sphinx expects a space between a short option and its
+			// parameter.
+			name += " " + d.Param
+		default:
+			name += "=" + d.Param
+		}
+		if d.Short != "" {
+			name = "-" + d.Short + ", " + name
+		}
+		fmt.Fprintf(w, "\n.. option:: %s\n", name)
+		if d.Help != "" {
+			fmt.Fprintf(w, "\n   %s\n", d.Help)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRST(t *testing.T) {
+	opts := &struct {
+		Alpha   string `flag:"--alpha=LEVEL set the alpha level"`
+		Color   string `flag:"--color=WHEN {optional-value=auto} colorize"`
+		Verbose bool   `flag:"-v --verbose be verbose"`
+		Name    string `flag:"-n"`
+		Ignored string `flag:"-"`
+		Hidden  bool   `flag:"--internal {hidden} an internal toggle"`
+	}{}
+	want := `
+.. program:: tool
+
+.. option:: --alpha=LEVEL
+
+   set the alpha level
+
+.. option:: --color[=WHEN]
+
+   colorize
+
+.. option:: -v, --verbose
+
+   be verbose
+
+.. option:: -n VALUE
+`[1:]
+	var out bytes.Buffer
+	if err := RST(&out, "tool", opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if err := RST(&out, "tool", "bad"); err == nil {
+		t.Errorf("did not get an error for bad options")
+	}
+}
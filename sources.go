@@ -0,0 +1,189 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// An Origin describes where the value of an option came from.
+type Origin string
+
+// The origins of an option's value.
+const (
+	OriginDefault = Origin("default") // the option has its default value
+	OriginFlag    = Origin("flag")    // set on the command line
+	OriginEnv     = Origin("env")     // set by EnvSource
+	OriginFile    = Origin("file")    // set by FileSource
+)
+
+// OriginOf returns the origin of the value of the option named flag registered
+// with set.  OriginDefault is returned if the option has not been set by the
+// most recent parse of set, its environment variable, EnvSource, or
+// FileSource.  When an option is set more than once the origin is that of the
+// last value.  The origins of the options set by a Source are only recorded
+// when the Source is passed to PreParse.
+func OriginOf(set FlagSet, flag string) Origin {
+	if v := lookupValue(set, flag); v != nil && v.origin != "" {
+		return v.origin
+	}
+	return OriginDefault
+}
+
+var (
+	applyingMu sync.Mutex
+	// applyingTo maps the options being passed to the PreParse functions
+	// to the set they are registered with.
+	applyingTo = map[any]*setInfo{}
+)
+
+// applying records that the PreParse functions are being called with opts,
+// registered with the set described by info, so that setOrigin can record the
+// origins of the options they set.  The returned function must be called once
+// they return.
+func applying(opts any, info *setInfo) func() {
+	applyingMu.Lock()
+	defer applyingMu.Unlock()
+	prev, ok := applyingTo[opts]
+	applyingTo[opts] = info
+	return func() {
+		applyingMu.Lock()
+		defer applyingMu.Unlock()
+		if ok {
+			applyingTo[opts] = prev
+		} else {
+			delete(applyingTo, opts)
+		}
+	}
+}
+
+// setOrigin records that the option named flag in opts was set from origin.
+// Nothing is recorded unless opts is being passed to the PreParse functions.
+func setOrigin(opts any, flag string, origin Origin) {
+	applyingMu.Lock()
+	info := applyingTo[opts]
+	applyingMu.Unlock()
+	if info == nil {
+		return
+	}
+	if v := info.lookup(flag); v != nil && v.opts == opts {
+		v.origin = origin
+	}
+}
+
+// A Source sets options in opts, a pointer to an options structure, from
+// somewhere other than the command line, such as the environment or a
+// configuration file.
+type Source func(opts any) error
+
+// ApplyDefaults applies each of sources, in order, to opts.  Values set by
+// later sources override those set by earlier sources.  ApplyDefaults does not
+// parse the command line and may be used when there is no command line.  When
+// opts is parsed, a Source is normally passed to PreParse instead, e.g.,
+// PreParse(FileSource(path)), so it overrides the environment variables read
+// when opts is registered.
+func ApplyDefaults(opts any, sources ...Source) error {
+	if _, err := fields(opts); err != nil {
+		return err
+	}
+	for _, source := range sources {
+		if err := source(opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnvSource returns a Source that sets each option with an {env=NAME}
+// attribute to the value of the environment variable NAME.  Options whose
+// environment variable is unset or empty are not changed.
+func EnvSource() Source {
+	return func(opts any) error {
+		fields, err := fields(opts)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			name := f.tag.attrs["env"]
+			if name == "" {
+				continue
+			}
+			if s := os.Getenv(name); s != "" {
+				if err := f.set(s); err != nil {
+					return fmt.Errorf("invalid value %q for environment variable %s: %v", s, name, err)
+				}
+				setOrigin(opts, f.tag.name, OriginEnv)
+			}
+		}
+		return nil
+	}
+}
+
+// FileSource returns a Source that sets options from the JSON object in the
+// file path.  The keys of the object are matched first against the names of
+// the options and then against the names of the fields.  A JSON string is
+// set as if it were provided on the command line, all other JSON values are
+// unmarshaled into the field.
+func FileSource(path string) Source {
+	return func(opts any) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return setJSON(opts, data)
+	}
+}
+
+// setJSON sets the options in opts from the JSON object in data.
+func setJSON(opts any, data []byte) error {
+	fields, err := fields(opts)
+	if err != nil {
+		return err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		raw, ok := m[f.tag.name]
+		if !ok {
+			if raw, ok = m[f.name]; !ok {
+				continue
+			}
+		}
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			err = f.set(s)
+		} else {
+			err = json.Unmarshal(raw, f.value.Addr().Interface())
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value %s for %s: %v", raw, f.tag.name, err)
+		}
+		setOrigin(opts, f.tag.name, OriginFile)
+	}
+	return nil
+}
+
+// set sets f to s as if it were provided on the command line.
+func (f *field) set(s string) error {
+	value, err := newValue(f.tag, f.value.Addr().Interface())
+	if err != nil {
+		return err
+	}
+	return value.Set(s)
+}
@@ -0,0 +1,211 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pborman/check"
+)
+
+type serverOptions struct {
+	Host    string        `flag:"--host=HOST {env=TEST_HOST} the host"`
+	Port    int           `flag:"--port=PORT {env=TEST_PORT} the port"`
+	Timeout time.Duration `flag:"--timeout {env=TEST_TIMEOUT} the timeout"`
+	Tags    []string      `flag:"--tag=TAG a tag"`
+	Name    string
+}
+
+func TestApplyDefaults(t *testing.T) {
+	t.Setenv("TEST_HOST", "env-host")
+	t.Setenv("TEST_PORT", "80")
+	t.Setenv("TEST_TIMEOUT", "")
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"port": 8080, "timeout": "5s", "tag": ["a", "b"], "Name": "bob"}`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &serverOptions{Host: "localhost"}
+	if err := ApplyDefaults(opts, EnvSource(), FileSource(path)); err != nil {
+		t.Fatal(err)
+	}
+	want := &serverOptions{
+		Host:    "env-host",
+		Port:    8080,
+		Timeout: 5 * time.Second,
+		Tags:    []string{"a", "b"},
+		Name:    "bob",
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+
+	// Reversing the order lets the environment override the file.
+	opts = &serverOptions{}
+	if err := ApplyDefaults(opts, FileSource(path), EnvSource()); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Port != 80 {
+		t.Errorf("got port %d, want 80", opts.Port)
+	}
+
+	t.Setenv("TEST_PORT", "eighty")
+	err := ApplyDefaults(&serverOptions{}, EnvSource())
+	if s := check.Error(err, `invalid value "eighty" for environment variable TEST_PORT: parse error`); s != "" {
+		t.Error(s)
+	}
+	err = ApplyDefaults(&serverOptions{}, FileSource(filepath.Join(t.TempDir(), "missing.json")))
+	if s := check.Error(err, "no such file or directory"); s != "" {
+		t.Error(s)
+	}
+	// A string from a source is a single element of an []string.
+	if err := os.WriteFile(path, []byte(`{"tag": "a,b"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts = &serverOptions{}
+	if err := ApplyDefaults(opts, FileSource(path)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a,b"}; !reflect.DeepEqual(opts.Tags, want) {
+		t.Errorf("got tags %q, want %q", opts.Tags, want)
+	}
+	err = ApplyDefaults("bad", EnvSource())
+	if s := check.Error(err, "string is not a pointer to a struct"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestEnvFallback(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Host  string `flag:"--host=HOST {env=TEST_HOST} the host"`
+		Port  int    `flag:"--port=PORT the port" env:"TEST_PORT"`
+		Debug bool   `flag:"--debug {env=TEST_DEBUG} debug mode"`
+	}
+	t.Setenv("TEST_HOST", "env-host")
+	t.Setenv("TEST_PORT", "80")
+	t.Setenv("TEST_DEBUG", "")
+	for _, tt := range []struct {
+		args []string
+		want options
+	}{
+		{args: []string{"c"}, want: options{Host: "env-host", Port: 80}},
+		{args: []string{"c", "--port", "8080", "--debug"}, want: options{Host: "env-host", Port: 8080, Debug: true}},
+	} {
+		opts := options{Host: "localhost"}
+		if _, err := SubRegisterAndParse(&opts, tt.args); err != nil {
+			t.Fatalf("%q: %v", tt.args, err)
+		}
+		if opts != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.args, opts, tt.want)
+		}
+	}
+
+	// The environment does not override a Source.
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"port": 443}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var opts options
+	if _, err := SubRegisterAndParse(&opts, []string{"c"}, PreParse(FileSource(path))); err != nil {
+		t.Fatal(err)
+	}
+	if want := (options{Host: "env-host", Port: 443}); opts != want {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+	opts = options{}
+	// Register and parse opts as RegisterAndParse does.
+	set := NewFlagSet("")
+	c := newParseConfig([]ParseOption{PreParse(FileSource(path))})
+	if err := c.register("c", &opts, set); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.preParse(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(set, nil, c); err != nil {
+		t.Fatal(err)
+	}
+	if want := (options{Host: "env-host", Port: 443}); opts != want {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+	for flag, want := range map[string]Origin{
+		"host":  OriginEnv,
+		"port":  OriginFile,
+		"debug": OriginDefault,
+	} {
+		if got := OriginOf(set, flag); got != want {
+			t.Errorf("got %s origin %q, want %q", flag, got, want)
+		}
+	}
+
+	// The command line only determines the origin for the most recent parse.
+	for _, tt := range []struct {
+		args []string
+		want Origin
+	}{
+		{[]string{"--debug", "--port=1"}, OriginFlag},
+		{nil, OriginDefault},
+	} {
+		if err := parse(set, tt.args, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := OriginOf(set, "debug"); got != tt.want {
+			t.Errorf("%q: got debug origin %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	// An invalid environment value is reported unless the flag is set.
+	t.Setenv("TEST_PORT", "eighty")
+	_, err := SubRegisterAndParse(&options{}, []string{"c"})
+	var ferr *FieldError
+	if !errors.As(err, &ferr) || ferr.Flag != "port" {
+		t.Errorf("got error %v, want a FieldError for port", err)
+	}
+	if s := check.Error(err, `invalid value "eighty" for flag -port: from environment variable TEST_PORT: parse error`); s != "" {
+		t.Error(s)
+	}
+	if _, err := SubRegisterAndParse(&options{}, []string{"c", "--port", "81"}); err != nil {
+		t.Errorf("port set: %v", err)
+	}
+
+	// Validate does not set its argument from the environment.
+	opts = options{}
+	Validate(&opts)
+	if opts != (options{}) {
+		t.Errorf("Validate set %+v", opts)
+	}
+
+	// The env tag is included in the help.
+	var help bytes.Buffer
+	Help(&help, "", "", &options{})
+	if got := help.String(); !strings.Contains(got, "TEST_PORT     --port") {
+		t.Errorf("help missing TEST_PORT:\n%s", got)
+	}
+	_, err = SubRegisterAndParse(&struct {
+		Port int `flag:"--port {env=PORT}" env:"OTHER_PORT"`
+	}{}, []string{"c"})
+	if s := check.Error(err, `{env=PORT} conflicts with env tag "OTHER_PORT"`); s != "" {
+		t.Error(s)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	validatorsMu sync.Mutex
+	validators   = map[string]func(string) error{}
+)
+
+// RegisterValidator registers fn as the validator named name.  Options with
+// the attribute {validate=name} are validated by calling fn with the value
+// provided before the option is set.  If fn returns an error the option is
+// not set and the error is returned.  Registering a validator with the name of
+// an existing validator replaces it.
+//
+// Validators are normally registered by init functions.
+func RegisterValidator(name string, fn func(string) error) {
+	validatorsMu.Lock()
+	validators[name] = fn
+	validatorsMu.Unlock()
+}
+
+// lookupValidator returns the validator named name or nil.
+func lookupValidator(name string) func(string) error {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	return validators[name]
+}
+
+// A validated is a Value that is validated before being set.
+type validated struct {
+	Value
+	validate func(string) error
+}
+
+// newValidated returns value wrapped by the validator named by the
+// {validate} attribute in o.
+func newValidated(o *optTag, value Value) (Value, error) {
+	name := o.attrs["validate"]
+	fn := lookupValidator(name)
+	if fn == nil {
+		return nil, fmt.Errorf("unknown validator %q for flag %s", name, o.name)
+	}
+	return &validated{Value: value, validate: fn}, nil
+}
+
+// newValidatedAny returns value wrapped by the validators named by the
+// {validate-any} attribute in o.  A value is valid if any of the validators
+// accepts it.
+func newValidatedAny(o *optTag, value Value) (Value, error) {
+	var names []string
+	var fns []func(string) error
+	for _, name := range strings.Split(o.attrs["validate-any"], ",") {
+		name = strings.TrimSpace(name)
+		fn := lookupValidator(name)
+		if fn == nil {
+			return nil, fmt.Errorf("unknown validator %q for flag %s", name, o.name)
+		}
+		names = append(names, name)
+		fns = append(fns, fn)
+	}
+	validate := func(s string) error {
+		msgs := make([]string, len(fns))
+		for x, fn := range fns {
+			err := fn(s)
+			if err == nil {
+				return nil
+			}
+			msgs[x] = names[x] + ": " + err.Error()
+		}
+		return fmt.Errorf("no validator accepted the value (%s)", strings.Join(msgs, "; "))
+	}
+	return &validated{Value: value, validate: validate}, nil
+}
+
+func (v *validated) Set(s string) error {
+	if err := v.validate(s); err != nil {
+		return err
+	}
+	return v.Value.Set(s)
+}
+
+func (v *validated) Get() any {
+	return getValue(v.Value)
+}
+
+func (v *validated) IsBoolFlag() bool {
+	return isBoolValue(v.Value)
+}
+
+// A choiceValue is a Value that may only be set to one of a list of choices.
+type choiceValue struct {
+	Value
+	choices []string
+}
+
+// newChoiceValue returns value restricted to the choices in o.  An error is
+// returned if def, the field's default, is set and is not one of the
+// choices.
+func newChoiceValue(o *optTag, value Value, def reflect.Value) (Value, error) {
+	c := &choiceValue{Value: value, choices: o.choices()}
+	if def.IsZero() {
+		return c, nil
+	}
+	s := value.String()
+	for _, choice := range c.choices {
+		if s == choice {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("default %q for flag %s is not one of %s", s, o.name, strings.Join(c.choices, ", "))
+}
+
+func (c *choiceValue) Set(s string) error {
+	for _, choice := range c.choices {
+		if s == choice {
+			return c.Value.Set(s)
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(c.choices, ", "))
+}
+
+func (c *choiceValue) Get() any {
+	return getValue(c.Value)
+}
+
+func (c *choiceValue) IsBoolFlag() bool {
+	return isBoolValue(c.Value)
+}
+
+// A bounded is a Value whose numeric field must be within the inclusive range
+// declared by the {min} and {max} attributes.  The field is restored to its
+// previous value when it is set to a value out of range.
+type bounded struct {
+	Value
+	field    reflect.Value
+	min, max *big.Float // nil if unbounded
+}
+
+// newBounded returns value, which sets field, restricted to the range in o.
+// An error is returned if the field's default is set and out of range.
+func newBounded(o *optTag, value Value, field reflect.Value) (Value, error) {
+	if numeric(field) == nil {
+		return nil, fmt.Errorf("{min} and {max} require a number, not %v", field.Type())
+	}
+	b := &bounded{Value: value, field: field}
+	for _, bound := range []struct {
+		name string
+		p    **big.Float
+	}{{"min", &b.min}, {"max", &b.max}} {
+		if !o.hasAttr(bound.name) {
+			continue
+		}
+		v, ok := new(big.Float).SetString(o.attrs[bound.name])
+		if !ok {
+			return nil, fmt.Errorf("{%s} requires a number: %q", bound.name, o.attrs[bound.name])
+		}
+		*bound.p = v
+	}
+	if b.min != nil && b.max != nil && b.min.Cmp(b.max) > 0 {
+		return nil, fmt.Errorf("{min} %v is greater than {max} %v for flag %s", b.min, b.max, o.name)
+	}
+	if !field.IsZero() {
+		if err := b.check(); err != nil {
+			return nil, fmt.Errorf("default for flag %s: %v", o.name, err)
+		}
+	}
+	return b, nil
+}
+
+// numeric returns the value of v as a *big.Float or nil if v is not a number.
+func numeric(v reflect.Value) *big.Float {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Float).SetInt64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Float).SetUint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return new(big.Float).SetFloat64(v.Float())
+	}
+	return nil
+}
+
+// check returns an error if the field is out of range.
+func (b *bounded) check() error {
+	v := numeric(b.field)
+	if (b.min == nil || v.Cmp(b.min) >= 0) && (b.max == nil || v.Cmp(b.max) <= 0) {
+		return nil
+	}
+	switch {
+	case b.max == nil:
+		return fmt.Errorf("value %v is less than %v", b.field.Interface(), b.min)
+	case b.min == nil:
+		return fmt.Errorf("value %v is greater than %v", b.field.Interface(), b.max)
+	}
+	return fmt.Errorf("value %v out of range [%v,%v]", b.field.Interface(), b.min, b.max)
+}
+
+func (b *bounded) Set(s string) error {
+	old := reflect.New(b.field.Type()).Elem()
+	old.Set(b.field)
+	if err := b.Value.Set(s); err != nil {
+		return err
+	}
+	if err := b.check(); err != nil {
+		b.field.Set(old)
+		return err
+	}
+	return nil
+}
+
+func (b *bounded) Get() any {
+	return getValue(b.Value)
+}
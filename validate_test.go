@@ -0,0 +1,257 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pborman/check"
+)
+
+func init() {
+	RegisterValidator("hostname", func(s string) error {
+		if s == "" || strings.ContainsAny(s, " _/") {
+			return errors.New("not a valid hostname")
+		}
+		return nil
+	})
+	RegisterValidator("uuid", func(s string) error {
+		if len(s) != 36 || strings.Count(s, "-") != 4 {
+			return errors.New("not a uuid")
+		}
+		return nil
+	})
+	RegisterValidator("shortname", func(s string) error {
+		if s == "" || len(s) > 8 {
+			return errors.New("not a short name")
+		}
+		return nil
+	})
+}
+
+func TestValidator(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Host string `flag:"--host=HOST {validate=hostname} the host"`
+	}
+	var opts options
+	if _, err := SubRegisterAndParse(&opts, []string{"c", "--host", "example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Host != "example.com" {
+		t.Errorf("got host %q, want %q", opts.Host, "example.com")
+	}
+
+	opts = options{Host: "localhost"}
+	_, err := SubRegisterAndParse(&opts, []string{"c", "--host", "bad_host"})
+	if s := check.Error(err, `invalid value "bad_host" for flag -host: not a valid hostname`); s != "" {
+		t.Error(s)
+	}
+	if opts.Host != "localhost" {
+		t.Errorf("host changed to %q", opts.Host)
+	}
+
+	_, err = SubRegisterAndParse(&struct {
+		Email string `flag:"--email {validate=email}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, `unknown validator "email" for flag email`); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestValidateAny(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		ID string `flag:"--id=ID {validate-any=uuid,shortname} the id"`
+	}
+	for _, tt := range []struct {
+		id  string
+		err string
+	}{
+		{id: "123e4567-e89b-12d3-a456-426614174000"},
+		{id: "bob"},
+		{id: "not-a-short-name", err: "no validator accepted the value (uuid: not a uuid; shortname: not a short name)"},
+	} {
+		var opts options
+		_, err := SubRegisterAndParse(&opts, []string{"c", "--id", tt.id})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s: %s", tt.id, s)
+			continue
+		}
+		if err == nil && opts.ID != tt.id {
+			t.Errorf("got id %q, want %q", opts.ID, tt.id)
+		}
+	}
+
+	_, err := SubRegisterAndParse(&struct {
+		ID string `flag:"--id {validate-any=uuid,email}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, `unknown validator "email" for flag id`); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestChoiceDefaults(t *testing.T) {
+	type options struct {
+		Mode string `flag:"--mode=MODE {choices=fast,slow} the mode"`
+	}
+	for _, tt := range []struct {
+		name  string
+		opts  *options
+		panic string
+	}{
+		{name: "valid", opts: &options{Mode: "slow"}},
+		{name: "unset", opts: &options{}},
+		{name: "invalid", opts: &options{Mode: "quick"}, panic: `default "quick" for flag mode is not one of fast, slow`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if s := checkPanic(recover(), tt.panic); s != "" {
+					t.Error(s)
+				}
+			}()
+			Validate(tt.opts)
+		})
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Mode string `flag:"--mode=MODE {oneof=fast,slow,auto} the mode"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want string
+		err  string
+	}{
+		{args: []string{"c"}},
+		{args: []string{"c", "--mode", "auto"}, want: "auto"},
+		{args: []string{"c", "--mode", "quick"}, err: `invalid value "quick" for flag -mode: must be one of fast, slow, auto`},
+	} {
+		var opts options
+		_, err := SubRegisterAndParse(&opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if opts.Mode != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.args, opts.Mode, tt.want)
+		}
+	}
+
+	want := `
+Usage: c [--mode=MODE]
+  --mode=MODE    the mode (one of fast, slow, auto)
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "c", "", &options{})
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	defer func() {
+		if s := checkPanic(recover(), `invalid default "quick" for flag mode: must be one of fast, slow, auto`); s != "" {
+			t.Error(s)
+		}
+	}()
+	Validate(&struct {
+		Mode string `flag:"--mode=MODE {default=quick} {oneof=fast,slow,auto} the mode"`
+	}{})
+}
+
+func TestBounds(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Workers int     `flag:"--workers=N {min=1} {max=64} worker count"`
+		Ratio   float64 `flag:"--ratio=R {min=0} {max=0.5} the ratio"`
+		Retries uint8   `flag:"--retries=N {max=10} the retries"`
+		Offset  int64   `flag:"--offset=N {min=-5} the offset"`
+	}
+	for _, tt := range []struct {
+		args []string
+		err  string
+	}{
+		{args: []string{"c"}},
+		{args: []string{"c", "--workers=1", "--ratio=0.5", "--retries=10", "--offset=-5"}},
+		{args: []string{"c", "--workers=64", "--ratio=0", "--retries=0", "--offset=100"}},
+		{args: []string{"c", "--workers=100"}, err: `invalid value "100" for flag -workers: value 100 out of range [1,64]`},
+		{args: []string{"c", "--workers=0"}, err: "value 0 out of range [1,64]"},
+		{args: []string{"c", "--ratio=0.75"}, err: "value 0.75 out of range [0,0.5]"},
+		{args: []string{"c", "--retries=11"}, err: "value 11 is greater than 10"},
+		{args: []string{"c", "--offset=-6"}, err: "value -6 is less than -5"},
+		{args: []string{"c", "--workers=x"}, err: "parse error"},
+	} {
+		opts := &options{Workers: 4}
+		_, err := SubRegisterAndParse(opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+		}
+		if err != nil && opts.Workers != 4 {
+			t.Errorf("%q: workers changed to %d", tt.args, opts.Workers)
+		}
+	}
+
+	for _, tt := range []struct {
+		name  string
+		opts  any
+		panic string
+	}{{
+		name: "default",
+		opts: &struct {
+			Workers int `flag:"--workers=N {min=1} {max=64} worker count"`
+		}{Workers: 100},
+		panic: "default for flag workers: value 100 out of range [1,64]",
+	}, {
+		name: "tag default",
+		opts: &struct {
+			Workers int `flag:"--workers=N {default=0} {min=1} {max=64} worker count"`
+		}{},
+		panic: `invalid default "0" for flag workers: value 0 out of range [1,64]`,
+	}, {
+		name: "not a number",
+		opts: &struct {
+			Name string `flag:"--name=NAME {max=3}"`
+		}{},
+		panic: "{min} and {max} require a number, not string",
+	}, {
+		name: "bad bound",
+		opts: &struct {
+			Workers int `flag:"--workers=N {min=one}"`
+		}{},
+		panic: `{min} requires a number: "one"`,
+	}, {
+		name: "inverted",
+		opts: &struct {
+			Workers int `flag:"--workers=N {min=5} {max=1}"`
+		}{},
+		panic: "{min} 5 is greater than {max} 1 for flag workers",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if s := checkPanic(recover(), tt.panic); s != "" {
+					t.Error(s)
+				}
+			}()
+			Validate(tt.opts)
+		})
+	}
+}
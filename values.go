@@ -0,0 +1,1688 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// newValue returns the Value used to set opt, a pointer to a field, as
+// specified by o.
+func newValue(o *optTag, opt any) (Value, error) {
+	if v, err := attrValue(o, opt); v != nil || err != nil {
+		return v, err
+	}
+	switch t := opt.(type) {
+	case Value:
+		return t, nil
+	case Decoder:
+		return &decoderValue{d: t}, nil
+	case *[]string:
+		return (*list)(t), nil
+	case *[]int:
+		return (*intList)(t), nil
+	case *[]int64:
+		return (*int64List)(t), nil
+	case *[]float64:
+		return (*float64List)(t), nil
+	case *map[string]string:
+		return (*stringMap)(t), nil
+	case *time.Duration:
+		return (*durationValue)(t), nil
+	case *string:
+		return (*stringValue)(t), nil
+	case *int:
+		return (*intValue)(t), nil
+	case *int8:
+		return (*int8Value)(t), nil
+	case *int16:
+		return (*int16Value)(t), nil
+	case *int32:
+		return (*int32Value)(t), nil
+	case *int64:
+		return (*int64Value)(t), nil
+	case *uint:
+		return (*uintValue)(t), nil
+	case *uint8:
+		return (*uint8Value)(t), nil
+	case *uint16:
+		return (*uint16Value)(t), nil
+	case *uint32:
+		return (*uint32Value)(t), nil
+	case *uint64:
+		return (*uint64Value)(t), nil
+	case **big.Int:
+		return &bigIntValue{p: t}, nil
+	case **url.URL:
+		return &urlValue{p: t}, nil
+	case *net.IP:
+		return (*ipValue)(t), nil
+	case *net.IPNet:
+		return (*ipNetValue)(t), nil
+	case *float32:
+		return (*float32Value)(t), nil
+	case *float64:
+		return (*float64Value)(t), nil
+	case *bool:
+		return (*boolValue)(t), nil
+	case *atomic.Bool:
+		return (*atomicBool)(t), nil
+	case *atomic.Int32:
+		return (*atomicInt32)(t), nil
+	case *atomic.Int64:
+		return (*atomicInt64)(t), nil
+	case *atomic.Uint32:
+		return (*atomicUint32)(t), nil
+	case *atomic.Uint64:
+		return (*atomicUint64)(t), nil
+	}
+	// Named types, such as "type Env string", are treated as their
+	// underlying type.
+	t := reflect.TypeOf(opt).Elem()
+	if u := underlyingType(t); u != nil && u != t {
+		p := reflect.ValueOf(opt).Convert(reflect.PointerTo(u))
+		return newValue(o, p.Interface())
+	}
+	return nil, fmt.Errorf("invalid option type: %v", t)
+}
+
+// basicTypes maps a reflect.Kind to the unnamed type of that kind.
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// underlyingType returns the underlying type of t if t is a basic type, a
+// slice of an unnamed basic type, or a map[string]string.  nil is returned for
+// all other types.
+func underlyingType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Map {
+		if t.Key() == stringType && t.Elem() == stringType {
+			return reflect.MapOf(stringType, stringType)
+		}
+		return nil
+	}
+	if t.Kind() == reflect.Slice {
+		if e := t.Elem(); basicTypes[e.Kind()] == e {
+			return reflect.SliceOf(e)
+		}
+		return nil
+	}
+	return basicTypes[t.Kind()]
+}
+
+// isBoolValue reports whether v is a boolean value, i.e., one that does not
+// require a parameter.
+func isBoolValue(v Value) bool {
+	b, ok := v.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// getValue returns the value of v, as returned by its Get method, or nil if v
+// does not have a Get method.
+func getValue(v Value) any {
+	if g, ok := v.(interface{ Get() any }); ok {
+		return g.Get()
+	}
+	return nil
+}
+
+// attrValue returns the Value to use for opt, a pointer to a field, as
+// selected by the attributes in o.  nil, nil is returned if the attributes
+// do not select a special Value.
+func attrValue(o *optTag, opt any) (Value, error) {
+	if o.hasAttr("ranges") {
+		p, ok := opt.(*[]int)
+		if !ok {
+			return nil, fmt.Errorf("{ranges} requires an []int, not %v", reflect.TypeOf(opt).Elem())
+		}
+		return (*rangeList)(p), nil
+	}
+	if o.hasAttr("multiline") {
+		p, ok := opt.(*string)
+		if !ok {
+			return nil, fmt.Errorf("{multiline} requires a string, not %v", reflect.TypeOf(opt).Elem())
+		}
+		return (*multiline)(p), nil
+	}
+	if o.hasAttr("fromdir") {
+		p, ok := opt.(*[]string)
+		if !ok {
+			return nil, fmt.Errorf("{fromdir} requires an []string, not %v", reflect.TypeOf(opt).Elem())
+		}
+		return (*dirList)(p), nil
+	}
+	if o.hasAttr("count") {
+		p, ok := opt.(*int)
+		if !ok {
+			return nil, fmt.Errorf("{count} requires an int, not %v", reflect.TypeOf(opt).Elem())
+		}
+		if o.hasAttr("min") || o.hasAttr("max") {
+			return nil, fmt.Errorf("{count} may not have {min} or {max}, use {count=N} to limit the count")
+		}
+		c := &counter{p: p}
+		if n := o.attrs["count"]; n != "" {
+			max, err := strconv.Atoi(n)
+			if err != nil || max < 1 {
+				return nil, fmt.Errorf("{count=N} requires a positive N: %q", n)
+			}
+			c.max = max
+		}
+		return c, nil
+	}
+	if o.hasAttr("clock") {
+		p, ok := opt.(*time.Duration)
+		if !ok {
+			return nil, fmt.Errorf("{clock} requires a time.Duration, not %v", reflect.TypeOf(opt).Elem())
+		}
+		return (*clockDuration)(p), nil
+	}
+	if o.hasAttr("pem") {
+		switch p := opt.(type) {
+		case **x509.Certificate:
+			return &pemCertificate{p: p}, nil
+		case *tls.Certificate:
+			return &pemKeyPair{p: p}, nil
+		}
+		return nil, fmt.Errorf("{pem} requires a *x509.Certificate or tls.Certificate, not %v", reflect.TypeOf(opt).Elem())
+	}
+	if o.hasAttr("glob") || o.hasAttr("glob-allow-empty") {
+		p, ok := opt.(*[]string)
+		if !ok {
+			return nil, fmt.Errorf("{glob} requires an []string, not %v", reflect.TypeOf(opt).Elem())
+		}
+		return &globList{p: p, allowEmpty: o.hasAttr("glob-allow-empty")}, nil
+	}
+	if o.hasAttr("kv-struct") {
+		return newKVStructs(opt)
+	}
+	if o.hasAttr("struct") {
+		return newStructValue(opt)
+	}
+	if o.hasAttr("sum") {
+		p, ok := opt.(*time.Duration)
+		if !ok {
+			return nil, fmt.Errorf("{sum} requires a time.Duration, not %v", reflect.TypeOf(opt).Elem())
+		}
+		return (*sumDuration)(p), nil
+	}
+	if o.hasAttr("ring") {
+		p, ok := opt.(*[]string)
+		if !ok {
+			return nil, fmt.Errorf("{ring} requires an []string, not %v", reflect.TypeOf(opt).Elem())
+		}
+		n, err := strconv.Atoi(o.attrs["ring"])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("{ring} requires a positive size: %q", o.attrs["ring"])
+		}
+		return &ring{p: p, n: n}, nil
+	}
+	if o.hasAttr("jsonl") {
+		v := reflect.ValueOf(opt).Elem()
+		if v.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("{jsonl} requires a slice, not %v", v.Type())
+		}
+		return &jsonLines{v: v}, nil
+	}
+	if o.hasAttr("keep-last") {
+		p, ok := opt.(*[]string)
+		if !ok {
+			return nil, fmt.Errorf("{keep-last} requires an []string, not %v", reflect.TypeOf(opt).Elem())
+		}
+		n, err := strconv.Atoi(o.attrs["keep-last"])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("{keep-last} requires a positive count: %q", o.attrs["keep-last"])
+		}
+		return &keepLast{p: p, n: n}, nil
+	}
+	if o.hasAttr("fetch") {
+		return newFetched(o, opt)
+	}
+	if o.hasAttr("any-port") {
+		p, ok := opt.(*Port)
+		if !ok {
+			return nil, fmt.Errorf("{any-port} requires a flags.Port, not %v", reflect.TypeOf(opt).Elem())
+		}
+		return (*anyPort)(p), nil
+	}
+	if o.hasAttr("flags") {
+		p, ok := opt.(*uint)
+		if !ok {
+			return nil, fmt.Errorf("{flags} requires a uint, not %v", reflect.TypeOf(opt).Elem())
+		}
+		return newBitmask(p, o.attrs["flags"])
+	}
+	return nil, nil
+}
+
+// The following errors are returned by the basic values.  They match the
+// errors returned by the standard flag package.
+var (
+	errParse = errors.New("parse error")
+	errRange = errors.New("value out of range")
+)
+
+// numError converts an error returned by strconv into errParse or errRange.
+func numError(err error) error {
+	ne, ok := err.(*strconv.NumError)
+	if !ok {
+		return err
+	}
+	switch ne.Err {
+	case strconv.ErrSyntax:
+		return errParse
+	case strconv.ErrRange:
+		return errRange
+	}
+	return err
+}
+
+// The following values implement the basic option types.  They behave the
+// same as their counterparts in the standard flag package.
+
+type stringValue string
+
+func (s *stringValue) Set(v string) error { *s = stringValue(v); return nil }
+func (s *stringValue) String() string     { return string(*s) }
+func (s *stringValue) Get() any           { return string(*s) }
+
+type boolValue bool
+
+func (b *boolValue) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return errParse
+	}
+	*b = boolValue(v)
+	return nil
+}
+func (b *boolValue) String() string   { return strconv.FormatBool(bool(*b)) }
+func (b *boolValue) Get() any         { return bool(*b) }
+func (b *boolValue) IsBoolFlag() bool { return true }
+
+type intValue int
+
+func (i *intValue) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, strconv.IntSize)
+	if err != nil {
+		return numError(err)
+	}
+	*i = intValue(v)
+	return nil
+}
+func (i *intValue) String() string { return strconv.Itoa(int(*i)) }
+func (i *intValue) Get() any       { return int(*i) }
+
+type int8Value int8
+
+func (i *int8Value) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, 8)
+	if err != nil {
+		return numError(err)
+	}
+	*i = int8Value(v)
+	return nil
+}
+func (i *int8Value) String() string { return strconv.FormatInt(int64(*i), 10) }
+func (i *int8Value) Get() any       { return int8(*i) }
+
+type int16Value int16
+
+func (i *int16Value) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, 16)
+	if err != nil {
+		return numError(err)
+	}
+	*i = int16Value(v)
+	return nil
+}
+func (i *int16Value) String() string { return strconv.FormatInt(int64(*i), 10) }
+func (i *int16Value) Get() any       { return int16(*i) }
+
+type int32Value int32
+
+func (i *int32Value) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, 32)
+	if err != nil {
+		return numError(err)
+	}
+	*i = int32Value(v)
+	return nil
+}
+func (i *int32Value) String() string { return strconv.FormatInt(int64(*i), 10) }
+func (i *int32Value) Get() any       { return int32(*i) }
+
+type int64Value int64
+
+func (i *int64Value) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return numError(err)
+	}
+	*i = int64Value(v)
+	return nil
+}
+func (i *int64Value) String() string { return strconv.FormatInt(int64(*i), 10) }
+func (i *int64Value) Get() any       { return int64(*i) }
+
+type uintValue uint
+
+func (i *uintValue) Set(s string) error {
+	v, err := strconv.ParseUint(s, 0, strconv.IntSize)
+	if err != nil {
+		return numError(err)
+	}
+	*i = uintValue(v)
+	return nil
+}
+func (i *uintValue) String() string { return strconv.FormatUint(uint64(*i), 10) }
+func (i *uintValue) Get() any       { return uint(*i) }
+
+type uint8Value uint8
+
+func (i *uint8Value) Set(s string) error {
+	v, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return numError(err)
+	}
+	*i = uint8Value(v)
+	return nil
+}
+func (i *uint8Value) String() string { return strconv.FormatUint(uint64(*i), 10) }
+func (i *uint8Value) Get() any       { return uint8(*i) }
+
+type uint16Value uint16
+
+func (i *uint16Value) Set(s string) error {
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return numError(err)
+	}
+	*i = uint16Value(v)
+	return nil
+}
+func (i *uint16Value) String() string { return strconv.FormatUint(uint64(*i), 10) }
+func (i *uint16Value) Get() any       { return uint16(*i) }
+
+type uint32Value uint32
+
+func (i *uint32Value) Set(s string) error {
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return numError(err)
+	}
+	*i = uint32Value(v)
+	return nil
+}
+func (i *uint32Value) String() string { return strconv.FormatUint(uint64(*i), 10) }
+func (i *uint32Value) Get() any       { return uint32(*i) }
+
+type uint64Value uint64
+
+func (i *uint64Value) Set(s string) error {
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return numError(err)
+	}
+	*i = uint64Value(v)
+	return nil
+}
+func (i *uint64Value) String() string { return strconv.FormatUint(uint64(*i), 10) }
+func (i *uint64Value) Get() any       { return uint64(*i) }
+
+// An intList is a list of ints.  Each time it is set the value is appended to
+// the list.
+type intList []int
+
+func (l *intList) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, strconv.IntSize)
+	if err != nil {
+		return numError(err)
+	}
+	*l = append(*l, int(v))
+	return nil
+}
+
+func (l *intList) String() string {
+	parts := make([]string, len(*l))
+	for i, n := range *l {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l *intList) Get() any { return []int(*l) }
+
+// An int64List is a list of int64s.  Each time it is set the value is appended
+// to the list.
+type int64List []int64
+
+func (l *int64List) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return numError(err)
+	}
+	*l = append(*l, v)
+	return nil
+}
+
+func (l *int64List) String() string {
+	parts := make([]string, len(*l))
+	for i, n := range *l {
+		parts[i] = strconv.FormatInt(n, 10)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l *int64List) Get() any { return []int64(*l) }
+
+// A float64List is a list of float64s.  Each time it is set the value is
+// appended to the list.
+type float64List []float64
+
+func (l *float64List) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return numError(err)
+	}
+	*l = append(*l, v)
+	return nil
+}
+
+func (l *float64List) String() string {
+	parts := make([]string, len(*l))
+	for i, f := range *l {
+		parts[i] = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l *float64List) Get() any { return []float64(*l) }
+
+// A stringMap is a map[string]string that is set from key=value pairs.  As
+// with a list, a value containing commas is split into multiple pairs and an
+// escaped comma, "\,", is a literal comma.  A repeated key replaces the
+// previous value.
+type stringMap map[string]string
+
+func (m *stringMap) Set(s string) error {
+	pairs := splitList(s)
+	for _, kv := range pairs {
+		if !strings.Contains(kv, "=") {
+			return fmt.Errorf("%q is not of the form key=value", kv)
+		}
+	}
+	if *m == nil {
+		*m = stringMap{}
+	}
+	for _, kv := range pairs {
+		key, value, _ := strings.Cut(kv, "=")
+		(*m)[key] = value
+	}
+	return nil
+}
+
+// String returns m as a comma separated list of key=value pairs sorted by key
+// that may be passed to Set.
+func (m *stringMap) String() string {
+	if m == nil {
+		return ""
+	}
+	keys := make([]string, 0, len(*m))
+	for key := range *m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	escape := strings.NewReplacer(",", `\,`)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = escape.Replace(key) + "=" + escape.Replace((*m)[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *stringMap) Get() any { return map[string]string(*m) }
+
+// A bigIntValue sets a *big.Int.  The value may be in any base accepted by
+// big.Int.SetString with a base of 0, e.g., "0x1f".
+type bigIntValue struct {
+	p **big.Int
+}
+
+func (b *bigIntValue) Set(s string) error {
+	v, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return errParse
+	}
+	*b.p = v
+	return nil
+}
+
+// String returns the decimal value of b.
+func (b *bigIntValue) String() string {
+	if b.p == nil || *b.p == nil {
+		return ""
+	}
+	return (*b.p).String()
+}
+
+func (b *bigIntValue) Get() any { return *b.p }
+
+// A Port is a TCP or UDP port number.  A Port option may only be set to a port
+// between 1 and 65535.  With the {any-port} attribute it may also be set to 0,
+// which conventionally means any port.
+type Port uint16
+
+func (p *Port) Set(s string) error {
+	return p.set(s, 1)
+}
+
+// set sets p to the port s, which must be at least min.
+func (p *Port) set(s string, min uint64) error {
+	v, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || v < min {
+		return fmt.Errorf("invalid port %q, must be between %d and 65535", s, min)
+	}
+	*p = Port(v)
+	return nil
+}
+
+func (p *Port) String() string {
+	if p == nil {
+		return "0"
+	}
+	return strconv.FormatUint(uint64(*p), 10)
+}
+
+func (p *Port) Get() any { return *p }
+
+// An anyPort is a Port that may also be set to 0.
+type anyPort Port
+
+func (p *anyPort) Set(s string) error { return (*Port)(p).set(s, 0) }
+func (p *anyPort) String() string     { return (*Port)(p).String() }
+func (p *anyPort) Get() any           { return Port(*p) }
+
+// A urlValue sets a *url.URL.  The URL must have a scheme and a host.
+type urlValue struct {
+	p **url.URL
+}
+
+func (u *urlValue) Set(s string) error {
+	v, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if v.Scheme == "" || v.Host == "" {
+		return fmt.Errorf("URL %q must have a scheme and a host", s)
+	}
+	*u.p = v
+	return nil
+}
+
+func (u *urlValue) String() string {
+	if u.p == nil || *u.p == nil {
+		return ""
+	}
+	return (*u.p).String()
+}
+
+func (u *urlValue) Get() any { return *u.p }
+
+// An ipValue is a net.IP set by net.ParseIP.
+type ipValue net.IP
+
+func (ip *ipValue) Set(s string) error {
+	v := net.ParseIP(s)
+	if v == nil {
+		return fmt.Errorf("invalid IP address %q", s)
+	}
+	*ip = ipValue(v)
+	return nil
+}
+
+func (ip *ipValue) String() string {
+	if ip == nil || *ip == nil {
+		return ""
+	}
+	return net.IP(*ip).String()
+}
+
+func (ip *ipValue) Get() any { return net.IP(*ip) }
+
+// An ipNetValue is a net.IPNet set by net.ParseCIDR.  The address is masked,
+// e.g., 10.1.2.3/8 sets the network 10.0.0.0/8.
+type ipNetValue net.IPNet
+
+func (n *ipNetValue) Set(s string) error {
+	_, v, err := net.ParseCIDR(s)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR address %q", s)
+	}
+	*n = ipNetValue(*v)
+	return nil
+}
+
+func (n *ipNetValue) String() string {
+	if n == nil || n.IP == nil {
+		return ""
+	}
+	return (*net.IPNet)(n).String()
+}
+
+func (n *ipNetValue) Get() any { return net.IPNet(*n) }
+
+type float32Value float32
+
+func (f *float32Value) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return numError(err)
+	}
+	*f = float32Value(v)
+	return nil
+}
+func (f *float32Value) String() string { return strconv.FormatFloat(float64(*f), 'g', -1, 32) }
+func (f *float32Value) Get() any       { return float32(*f) }
+
+type float64Value float64
+
+func (f *float64Value) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return numError(err)
+	}
+	*f = float64Value(v)
+	return nil
+}
+func (f *float64Value) String() string { return strconv.FormatFloat(float64(*f), 'g', -1, 64) }
+func (f *float64Value) Get() any       { return float64(*f) }
+
+type durationValue time.Duration
+
+func (d *durationValue) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errParse
+	}
+	*d = durationValue(v)
+	return nil
+}
+func (d *durationValue) String() string { return (*time.Duration)(d).String() }
+func (d *durationValue) Get() any       { return time.Duration(*d) }
+
+// The following values implement the types in sync/atomic.  They are set
+// and read using the atomic Store and Load methods.
+
+type atomicBool atomic.Bool
+
+func (b *atomicBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return errParse
+	}
+	(*atomic.Bool)(b).Store(v)
+	return nil
+}
+func (b *atomicBool) String() string   { return strconv.FormatBool((*atomic.Bool)(b).Load()) }
+func (b *atomicBool) Get() any         { return (*atomic.Bool)(b).Load() }
+func (b *atomicBool) IsBoolFlag() bool { return true }
+
+type atomicInt32 atomic.Int32
+
+func (i *atomicInt32) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, 32)
+	if err != nil {
+		return numError(err)
+	}
+	(*atomic.Int32)(i).Store(int32(v))
+	return nil
+}
+func (i *atomicInt32) String() string { return strconv.FormatInt(int64((*atomic.Int32)(i).Load()), 10) }
+func (i *atomicInt32) Get() any       { return (*atomic.Int32)(i).Load() }
+
+type atomicInt64 atomic.Int64
+
+func (i *atomicInt64) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return numError(err)
+	}
+	(*atomic.Int64)(i).Store(v)
+	return nil
+}
+func (i *atomicInt64) String() string { return strconv.FormatInt((*atomic.Int64)(i).Load(), 10) }
+func (i *atomicInt64) Get() any       { return (*atomic.Int64)(i).Load() }
+
+type atomicUint32 atomic.Uint32
+
+func (i *atomicUint32) Set(s string) error {
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return numError(err)
+	}
+	(*atomic.Uint32)(i).Store(uint32(v))
+	return nil
+}
+func (i *atomicUint32) String() string {
+	return strconv.FormatUint(uint64((*atomic.Uint32)(i).Load()), 10)
+}
+func (i *atomicUint32) Get() any { return (*atomic.Uint32)(i).Load() }
+
+type atomicUint64 atomic.Uint64
+
+func (i *atomicUint64) Set(s string) error {
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return numError(err)
+	}
+	(*atomic.Uint64)(i).Store(v)
+	return nil
+}
+func (i *atomicUint64) String() string { return strconv.FormatUint((*atomic.Uint64)(i).Load(), 10) }
+func (i *atomicUint64) Get() any       { return (*atomic.Uint64)(i).Load() }
+
+// A rangeList is a list of integers that is set from a comma separated list
+// of non-negative integers and inclusive ranges of integers.  Setting a
+// rangeList to "0-3,5" appends 0, 1, 2, 3, and 5 to the list.
+type rangeList []int
+
+func (l *rangeList) Set(s string) error {
+	var values []int
+	for _, r := range strings.Split(s, ",") {
+		los, his, isRange := strings.Cut(r, "-")
+		lo, err := strconv.Atoi(los)
+		if err != nil {
+			return fmt.Errorf("invalid range %q", r)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(his); err != nil {
+				return fmt.Errorf("invalid range %q", r)
+			}
+		}
+		if lo < 0 || hi < lo {
+			return fmt.Errorf("invalid range %q", r)
+		}
+		for n := lo; n <= hi; n++ {
+			values = append(values, n)
+		}
+	}
+	*l = append(*l, values...)
+	return nil
+}
+
+func (l *rangeList) String() string {
+	parts := make([]string, len(*l))
+	for i, n := range *l {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *rangeList) Get() any {
+	return []int(*l)
+}
+
+// stdin is read by values that read standard input.  It is replaced by tests.
+var stdin io.Reader = os.Stdin
+
+// A multiline is a string that is set to the entire contents of standard input,
+// newlines included, when set to "-".
+type multiline string
+
+func (m *multiline) Set(s string) error {
+	if s == "-" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		s = string(data)
+	}
+	*m = multiline(s)
+	return nil
+}
+
+func (m *multiline) String() string {
+	return string(*m)
+}
+
+func (m *multiline) Get() any {
+	return string(*m)
+}
+
+// A dirList is a list of strings that is set from the name of a directory.
+// The non-empty lines of each regular file in the directory, in file name
+// order, are appended to the list.  Subdirectories are skipped.
+type dirList []string
+
+func (l *dirList) Set(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		flines, err := readLines(path)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, flines...)
+	}
+	*l = append(*l, lines...)
+	return nil
+}
+
+func (l *dirList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *dirList) Get() any {
+	return []string(*l)
+}
+
+// A globList is a list of strings that is set from a glob pattern.  The
+// paths matching the pattern are appended to the list.  It is an error for a
+// pattern to match nothing unless allowEmpty is set.
+type globList struct {
+	p          *[]string
+	allowEmpty bool
+}
+
+func (g *globList) Set(pattern string) error {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 && !g.allowEmpty {
+		return fmt.Errorf("no files match %s", pattern)
+	}
+	*g.p = append(*g.p, paths...)
+	return nil
+}
+
+func (g *globList) String() string {
+	if g.p == nil {
+		return ""
+	}
+	return strings.Join(*g.p, " ")
+}
+
+func (g *globList) Get() any {
+	return *g.p
+}
+
+// readLines returns the non-empty lines in the file path.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := s.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, s.Err()
+}
+
+// A kvStructs is a slice of structures.  Each time it is set a new element is
+// appended that is set from a comma separated list of key=value pairs, e.g.,
+// "src=a,dst=b".  The keys are the names of the options declared by the
+// element's structure.
+type kvStructs struct {
+	v reflect.Value // the slice
+}
+
+// newKVStructs returns a kvStructs for opt, which must be a pointer to a
+// slice of structures that declare options.
+func newKVStructs(opt any) (Value, error) {
+	v := reflect.ValueOf(opt).Elem()
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("{kv-struct} requires a slice of structures, not %v", v.Type())
+	}
+	if _, err := fields(reflect.New(v.Type().Elem()).Interface()); err != nil {
+		return nil, err
+	}
+	return &kvStructs{v: v}, nil
+}
+
+func (k *kvStructs) Set(s string) error {
+	elem := reflect.New(k.v.Type().Elem())
+	if err := setKV(elem.Interface(), s); err != nil {
+		return err
+	}
+	k.v.Set(reflect.Append(k.v, elem.Elem()))
+	return nil
+}
+
+// setKV sets the options declared by opts, a pointer to a structure, from s,
+// a comma separated list of key=value pairs.
+func setKV(opts any, s string) error {
+	fields, _ := fields(opts)
+	for _, kv := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("%q is not of the form key=value", kv)
+		}
+		f := findField(fields, key)
+		if f == nil {
+			return fmt.Errorf("unknown key %q", key)
+		}
+		if err := f.set(value); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// kvString returns the options declared by opts, a pointer to a structure,
+// that do not have the zero value as a comma separated list of key=value
+// pairs.
+func kvString(opts any) string {
+	fields, _ := fields(opts)
+	var kvs []string
+	for _, f := range fields {
+		if f.value.IsZero() {
+			continue
+		}
+		v, err := newValue(f.tag, f.value.Addr().Interface())
+		if err != nil {
+			continue
+		}
+		kvs = append(kvs, f.tag.name+"="+v.String())
+	}
+	return strings.Join(kvs, ",")
+}
+
+// A structValue is a structure set from a comma separated list of key=value
+// pairs, e.g., "type=s3,region=us-east-1".  The keys are the names of the
+// options declared by the structure.  Options not in the list are unchanged.
+type structValue struct {
+	v reflect.Value // the structure
+}
+
+// newStructValue returns a structValue for opt, which must be a pointer to a
+// structure that declares options.
+func newStructValue(opt any) (Value, error) {
+	v := reflect.ValueOf(opt).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("{struct} requires a structure, not %v", v.Type())
+	}
+	if _, err := fields(opt); err != nil {
+		return nil, err
+	}
+	return &structValue{v: v}, nil
+}
+
+func (sv *structValue) Set(s string) error {
+	// Set a copy so the structure is unchanged on error.
+	p := reflect.New(sv.v.Type())
+	p.Elem().Set(sv.v)
+	if err := setKV(p.Interface(), s); err != nil {
+		return err
+	}
+	sv.v.Set(p.Elem())
+	return nil
+}
+
+func (sv *structValue) String() string {
+	if !sv.v.IsValid() {
+		return ""
+	}
+	return kvString(sv.v.Addr().Interface())
+}
+
+func (sv *structValue) Get() any {
+	return sv.v.Interface()
+}
+
+// findField returns the field in fields that declares the option name, or nil.
+func findField(fields []field, name string) *field {
+	for i := range fields {
+		if t := fields[i].tag; t.name == name || (t.short != "" && t.short == name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+func (k *kvStructs) String() string {
+	if !k.v.IsValid() {
+		return ""
+	}
+	elems := make([]string, k.v.Len())
+	for i := range elems {
+		elems[i] = kvString(k.v.Index(i).Addr().Interface())
+	}
+	return strings.Join(elems, " ")
+}
+
+func (k *kvStructs) Get() any {
+	return k.v.Interface()
+}
+
+// A jsonLines is a slice that is set from the name of a JSON Lines file, e.g.,
+// "@records.jsonl".  Each non-blank line of the file is unmarshaled into a new
+// element that is appended to the slice.
+type jsonLines struct {
+	v    reflect.Value // the slice
+	path string
+}
+
+func (j *jsonLines) Set(s string) error {
+	path := strings.TrimPrefix(s, "@")
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	elems := reflect.MakeSlice(j.v.Type(), 0, 0)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<24)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		elem := reflect.New(j.v.Type().Elem())
+		if err := json.Unmarshal(line, elem.Interface()); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		elems = reflect.Append(elems, elem.Elem())
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	j.v.Set(reflect.AppendSlice(j.v, elems))
+	j.path = s
+	return nil
+}
+
+func (j *jsonLines) String() string {
+	return j.path
+}
+
+func (j *jsonLines) Get() any {
+	return j.v.Interface()
+}
+
+// A keepLast is a list of strings that retains only the last n values it is
+// set to.
+type keepLast struct {
+	p *[]string
+	n int
+}
+
+func (k *keepLast) Set(s string) error {
+	*k.p = append(*k.p, s)
+	if extra := len(*k.p) - k.n; extra > 0 {
+		*k.p = append((*k.p)[:0:0], (*k.p)[extra:]...)
+	}
+	return nil
+}
+
+func (k *keepLast) String() string {
+	if k.p == nil {
+		return ""
+	}
+	return strings.Join(*k.p, " ")
+}
+
+func (k *keepLast) Get() any {
+	return *k.p
+}
+
+// A bitmask is a uint set from a list of names, each of which names a bit.
+// The bits named by the list are OR'd together.
+type bitmask struct {
+	p     *uint
+	names []string // the names in the order declared
+	bits  map[string]uint
+}
+
+// newBitmask returns a bitmask that sets p as declared by decl, a list of
+// NAME:BIT pairs, e.g., "a:1,b:2,c:4".
+func newBitmask(p *uint, decl string) (*bitmask, error) {
+	b := &bitmask{p: p, bits: map[string]uint{}}
+	for _, pair := range strings.Split(decl, ",") {
+		name, bit, ok := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("{flags} requires NAME:BIT pairs: %q", decl)
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(bit), 0, strconv.IntSize)
+		if err != nil {
+			return nil, fmt.Errorf("{flags} invalid bit for %s: %q", name, bit)
+		}
+		if _, ok := b.bits[name]; ok {
+			return nil, fmt.Errorf("{flags} declares %s more than once", name)
+		}
+		b.names = append(b.names, name)
+		b.bits[name] = uint(v)
+	}
+	return b, nil
+}
+
+func (b *bitmask) Set(s string) error {
+	var v uint
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		bit, ok := b.bits[name]
+		if !ok {
+			return fmt.Errorf("unknown name %q, must be one of %s", name, strings.Join(b.names, ", "))
+		}
+		v |= bit
+	}
+	*b.p = v
+	return nil
+}
+
+// String returns the names of the bits that are set, followed by the value of
+// any bits that are not named.
+func (b *bitmask) String() string {
+	if b == nil || b.p == nil {
+		return ""
+	}
+	v := *b.p
+	var names []string
+	for _, name := range b.names {
+		if bit := b.bits[name]; bit != 0 && v&bit == bit {
+			names = append(names, name)
+			v &^= bit
+		}
+	}
+	if v != 0 {
+		names = append(names, fmt.Sprintf("%#x", v))
+	}
+	return strings.Join(names, ",")
+}
+
+func (b *bitmask) Get() any {
+	return *b.p
+}
+
+// A ring is a list of strings used as a ring buffer of n elements.  Once the
+// list has n elements, each new value overwrites the oldest value in place
+// rather than shifting the list as keepLast does.
+type ring struct {
+	p    *[]string
+	n    int
+	next int // index of the oldest value once the ring is full
+}
+
+func (r *ring) Set(s string) error {
+	if len(*r.p) < r.n {
+		*r.p = append(*r.p, s)
+		return nil
+	}
+	(*r.p)[r.next] = s
+	r.next = (r.next + 1) % r.n
+	return nil
+}
+
+func (r *ring) String() string {
+	if r.p == nil {
+		return ""
+	}
+	return strings.Join(*r.p, " ")
+}
+
+func (r *ring) Get() any {
+	return *r.p
+}
+
+// A preset is a boolean value that sets another flag to a fixed value when it
+// is set to true.  The flag is resolved when the preset is set so it may be
+// registered after the preset.
+type preset struct {
+	Value
+	info  *setInfo
+	flag  string // the flag to set
+	value string // the value to set flag to
+}
+
+// newPreset returns a preset that wraps value, as declared by the {preset}
+// attribute in o.
+func newPreset(o *optTag, value Value, info *setInfo) (Value, error) {
+	flag, pvalue, ok := strings.Cut(o.attrs["preset"], ":")
+	if !ok || flag == "" {
+		return nil, fmt.Errorf("{preset} requires FLAG:VALUE: %q", o.attrs["preset"])
+	}
+	if !isBoolValue(value) {
+		return nil, fmt.Errorf("{preset} requires a bool flag: %s", o.name)
+	}
+	return &preset{Value: value, info: info, flag: flag, value: pvalue}, nil
+}
+
+func (p *preset) Set(s string) error {
+	if err := p.Value.Set(s); err != nil {
+		return err
+	}
+	if p.Value.String() != "true" {
+		return nil
+	}
+	v := p.info.lookup(p.flag)
+	if v == nil {
+		return fmt.Errorf("preset flag %s is not defined", p.flag)
+	}
+	return v.Set(p.value)
+}
+
+func (p *preset) Get() any {
+	return getValue(p.Value)
+}
+
+func (p *preset) IsBoolFlag() bool {
+	return true
+}
+
+// A counter is an int that is incremented each time it is set without a
+// value.  If max is not 0 the counter does not exceed max.  A counter set to
+// an explicit number is set to that number.
+type counter struct {
+	p   *int
+	max int
+}
+
+func (c *counter) Set(s string) error {
+	n := *c.p + 1
+	if s != "true" {
+		v, err := strconv.ParseInt(s, 0, strconv.IntSize)
+		if err != nil {
+			return numError(err)
+		}
+		n = int(v)
+	}
+	if c.max > 0 && n > c.max {
+		n = c.max
+	}
+	*c.p = n
+	return nil
+}
+
+func (c *counter) String() string {
+	if c.p == nil {
+		return "0"
+	}
+	return strconv.Itoa(*c.p)
+}
+
+func (c *counter) Get() any {
+	return *c.p
+}
+
+func (c *counter) IsBoolFlag() bool {
+	return true
+}
+
+// An optionalValue is a Value whose parameter is optional.  It is registered
+// as a boolean flag so the standard flag package does not consume the
+// following argument.  When set without a parameter, which the flag package
+// reports as "true", the Value is set to present.
+type optionalValue struct {
+	Value
+	present string
+}
+
+func (o *optionalValue) Set(s string) error {
+	if s == "true" {
+		s = o.present
+	}
+	return o.Value.Set(s)
+}
+
+func (o *optionalValue) Get() any {
+	return getValue(o.Value)
+}
+
+func (o *optionalValue) IsBoolFlag() bool {
+	return true
+}
+
+// A clockDuration is a time.Duration that may also be set using clock
+// notation: HH:MM:SS, MM:SS, or SS.  Minutes and seconds following a colon
+// must be less than 60.
+type clockDuration time.Duration
+
+func (d *clockDuration) Set(s string) error {
+	if strings.Contains(s, ":") || (s != "" && strings.Trim(s, "0123456789") == "") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return fmt.Errorf("invalid clock duration %q", s)
+		}
+		var v time.Duration
+		for x, part := range parts {
+			n, err := strconv.ParseUint(part, 10, 32)
+			if err != nil || (x > 0 && n >= 60) {
+				return fmt.Errorf("invalid clock duration %q", s)
+			}
+			v = v*60 + time.Duration(n)
+		}
+		*d = clockDuration(v * time.Second)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errParse
+	}
+	*d = clockDuration(v)
+	return nil
+}
+
+func (d *clockDuration) String() string { return (*time.Duration)(d).String() }
+func (d *clockDuration) Get() any       { return time.Duration(*d) }
+
+// A sumDuration is a time.Duration that is set to the sum of a comma
+// separated list of durations, e.g., "1h,30m,15s" is 1h45m15s.
+type sumDuration time.Duration
+
+func (d *sumDuration) Set(s string) error {
+	var sum time.Duration
+	for _, part := range strings.Split(s, ",") {
+		v, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", part)
+		}
+		sum += v
+	}
+	*d = sumDuration(sum)
+	return nil
+}
+
+func (d *sumDuration) String() string { return (*time.Duration)(d).String() }
+func (d *sumDuration) Get() any       { return time.Duration(*d) }
+
+// A listFilter is a Value that sets an []string and then sorts the list and
+// or removes duplicate values from the list.
+type listFilter struct {
+	Value
+	p      *[]string
+	sorted bool
+	dedup  bool
+}
+
+// newListFilter returns value, which sets opt, wrapped in a listFilter as
+// specified by the {sorted} and {dedup} attributes in o.
+func newListFilter(o *optTag, opt any, value Value) (Value, error) {
+	p, ok := opt.(*[]string)
+	if !ok {
+		return nil, fmt.Errorf("{sorted} and {dedup} require an []string, not %v", reflect.TypeOf(opt).Elem())
+	}
+	// The values retained by {keep-last} and {ring} depend on the order
+	// they were set in, which {sorted} and {dedup} change.
+	if o.hasAttr("keep-last") || o.hasAttr("ring") {
+		return nil, fmt.Errorf("{sorted} and {dedup} may not be used with {keep-last} or {ring}")
+	}
+	return &listFilter{
+		Value:  value,
+		p:      p,
+		sorted: o.hasAttr("sorted"),
+		dedup:  o.hasAttr("dedup"),
+	}, nil
+}
+
+func (l *listFilter) Set(s string) error {
+	if err := l.Value.Set(s); err != nil {
+		return err
+	}
+	if l.sorted {
+		sort.Strings(*l.p)
+	}
+	if l.dedup {
+		seen := map[string]bool{}
+		values := (*l.p)[:0]
+		for _, v := range *l.p {
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+		*l.p = values
+	}
+	return nil
+}
+
+func (l *listFilter) Get() any {
+	return getValue(l.Value)
+}
+
+// A deprecated is a Value that generates a warning each time it is set.
+type deprecated struct {
+	Value
+	info *setInfo
+	msg  string
+}
+
+// deprecation returns the warning for the deprecated flag o.
+func (o *optTag) deprecation() string {
+	name := "--" + o.name
+	if len(o.name) == 1 {
+		name = "-" + o.name
+	}
+	if use := o.attrs["deprecated"]; use != "" {
+		return fmt.Sprintf("flag %s is deprecated, use %s instead", name, use)
+	}
+	return fmt.Sprintf("flag %s is deprecated", name)
+}
+
+func (d *deprecated) Set(s string) error {
+	if err := d.Value.Set(s); err != nil {
+		return err
+	}
+	d.info.warn(d.msg)
+	return nil
+}
+
+func (d *deprecated) Get() any {
+	return getValue(d.Value)
+}
+
+func (d *deprecated) IsBoolFlag() bool {
+	return isBoolValue(d.Value)
+}
+
+// A negated is the Value of the --no-NAME flag of a {negatable} boolean
+// option.  Setting it to true sets the option to false.
+type negated struct {
+	v *flagValue
+}
+
+func (n *negated) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	return n.v.Set(strconv.FormatBool(!b))
+}
+
+func (n *negated) String() string {
+	if n == nil || n.v == nil || n.v.Value == nil {
+		return "false"
+	}
+	return strconv.FormatBool(n.v.String() == "false")
+}
+
+func (n *negated) IsBoolFlag() bool { return true }
+
+// readPEM returns the contents of the PEM file named by s.  The name may be
+// prefixed with an @, e.g., "@server.pem".
+func readPEM(s string) ([]byte, error) {
+	return os.ReadFile(strings.TrimPrefix(s, "@"))
+}
+
+// A pemCertificate is an *x509.Certificate that is set from the first
+// certificate in a PEM file.
+type pemCertificate struct {
+	p    **x509.Certificate
+	path string
+}
+
+func (c *pemCertificate) Set(s string) error {
+	data, err := readPEM(s)
+	if err != nil {
+		return err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return fmt.Errorf("%s: no PEM certificate found", strings.TrimPrefix(s, "@"))
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		*c.p = cert
+		c.path = s
+		return nil
+	}
+}
+
+func (c *pemCertificate) String() string {
+	return c.path
+}
+
+func (c *pemCertificate) Get() any {
+	return *c.p
+}
+
+// A pemKeyPair is a tls.Certificate that is set from a PEM file containing
+// both a certificate chain and its private key.  The Leaf of the certificate
+// is always set.
+type pemKeyPair struct {
+	p    *tls.Certificate
+	path string
+}
+
+func (k *pemKeyPair) Set(s string) error {
+	data, err := readPEM(s)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", strings.TrimPrefix(s, "@"), err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	*k.p = cert
+	k.path = s
+	return nil
+}
+
+func (k *pemKeyPair) String() string {
+	return k.path
+}
+
+func (k *pemKeyPair) Get() any {
+	return *k.p
+}
+
+// A rawValue is a Value that also records the text it was set to in raw, a
+// string field.
+type rawValue struct {
+	Value
+	raw reflect.Value
+}
+
+func (r *rawValue) Set(s string) error {
+	if err := r.Value.Set(s); err != nil {
+		return err
+	}
+	r.raw.SetString(s)
+	return nil
+}
+
+func (r *rawValue) Get() any {
+	return getValue(r.Value)
+}
+
+func (r *rawValue) IsBoolFlag() bool {
+	return isBoolValue(r.Value)
+}
+
+// A decoderValue is a Value that sets a Decoder using the context ctx.
+type decoderValue struct {
+	d   Decoder
+	ctx any
+}
+
+func (d *decoderValue) Set(s string) error {
+	return d.d.Decode(d.ctx, s)
+}
+
+// String returns the string value of the Decoder if it implements
+// fmt.Stringer.
+func (d *decoderValue) String() string {
+	if s, ok := d.d.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return ""
+}
+
+func (d *decoderValue) Get() any {
+	return d.d
+}
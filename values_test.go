@@ -0,0 +1,1408 @@
+// Copyright 2023 Paul Borman
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+
+package flags
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pborman/check"
+)
+
+func TestRanges(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	for _, tt := range []struct {
+		args []string
+		want []int
+		err  string
+	}{{
+		args: []string{"c", "--cpus", "0-3,5"},
+		want: []int{0, 1, 2, 3, 5},
+	}, {
+		args: []string{"c", "--cpus", "7", "--cpus", "1-2"},
+		want: []int{7, 1, 2},
+	}, {
+		args: []string{"c", "--cpus", "5-3"},
+		err:  `invalid range "5-3"`,
+	}, {
+		args: []string{"c", "--cpus", "1,x"},
+		err:  `invalid range "x"`,
+	}} {
+		opts := &struct {
+			CPUs []int `flag:"--cpus=LIST {ranges} cpus to use"`
+		}{}
+		_, err := SubRegisterAndParse(opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if !reflect.DeepEqual(opts.CPUs, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.args, opts.CPUs, tt.want)
+		}
+	}
+	_, err := SubRegisterAndParse(&struct {
+		CPUs []string `flag:"--cpus {ranges}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{ranges} requires an []int, not []string"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	defer func() { stdin = os.Stdin }()
+	script := "#!/bin/sh\necho hello\n\necho world\n"
+	stdin = strings.NewReader(script)
+	opts := &struct {
+		Script string `flag:"--script=FILE {multiline} the script to run"`
+		Other  string `flag:"--other {multiline}"`
+	}{}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--script", "-", "--other", "value"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Script != script {
+		t.Errorf("got script %q, want %q", opts.Script, script)
+	}
+	if opts.Other != "value" {
+		t.Errorf("got other %q, want %q", opts.Other, "value")
+	}
+}
+
+func TestFromDir(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"b.rules":     "rule3\n",
+		"a.rules":     "rule1\n\nrule2\n",
+		"sub/c.rules": "skipped\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := &struct {
+		Rules []string `flag:"--rules-dir=DIR {fromdir} directory of rules"`
+	}{}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--rules-dir", dir}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"rule1", "rule2", "rule3"}
+	if !reflect.DeepEqual(opts.Rules, want) {
+		t.Errorf("got %q, want %q", opts.Rules, want)
+	}
+	_, err := SubRegisterAndParse(opts, []string{"c", "--rules-dir", filepath.Join(dir, "missing")})
+	if s := check.Error(err, "no such file or directory"); s != "" {
+		t.Error(s)
+	}
+}
+
+// writePEM writes a self-signed certificate for name, followed by its key
+// when withKey is set, to a file in dir and returns the file's path.
+func writePEM(t *testing.T, dir, name string, withKey bool) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if withKey {
+		kder, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder})...)
+	}
+	path := filepath.Join(dir, name+".pem")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPEM(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	dir := t.TempDir()
+	ca := writePEM(t, dir, "ca", false)
+	server := writePEM(t, dir, "server", true)
+	bad := filepath.Join(dir, "bad.pem")
+	if err := os.WriteFile(bad, []byte("not a certificate\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &struct {
+		CA   *x509.Certificate `flag:"--ca=FILE {pem} the CA certificate"`
+		Cert tls.Certificate   `flag:"--cert=FILE {pem} the server certificate and key"`
+	}{}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--ca", ca, "--cert", "@" + server}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.CA == nil || opts.CA.Subject.CommonName != "ca" {
+		t.Errorf("got CA %v, want ca", opts.CA)
+	}
+	if opts.Cert.Leaf == nil || opts.Cert.Leaf.Subject.CommonName != "server" {
+		t.Errorf("got cert leaf %v, want server", opts.Cert.Leaf)
+	}
+	if opts.Cert.PrivateKey == nil {
+		t.Errorf("private key not loaded")
+	}
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "not pem", args: []string{"--ca", "@" + bad}, err: "no PEM certificate found"},
+		{name: "missing", args: []string{"--ca", filepath.Join(dir, "missing.pem")}, err: "no such file or directory"},
+		{name: "no key", args: []string{"--cert", ca}, err: "flag -cert"},
+		{name: "bad pair", args: []string{"--cert", bad}, err: "bad.pem"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &struct {
+				CA   *x509.Certificate `flag:"--ca=FILE {pem} the CA certificate"`
+				Cert tls.Certificate   `flag:"--cert=FILE {pem} the server certificate and key"`
+			}{}
+			_, err := SubRegisterAndParse(opts, append([]string{"c"}, tt.args...))
+			if s := check.Error(err, tt.err); s != "" {
+				t.Error(s)
+			}
+		})
+	}
+
+	_, err := SubRegisterAndParse(&struct {
+		Cert string `flag:"--cert=FILE {pem} the certificate"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{pem} requires"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	dir := t.TempDir()
+	for _, name := range []string{"b.txt", "a.txt", "c.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := &struct {
+		Files []string `flag:"--files=PATTERN {glob} files to read"`
+		Other []string `flag:"--other=PATTERN {glob-allow-empty} optional files"`
+	}{}
+	args := []string{"c",
+		"--files", filepath.Join(dir, "*.txt"),
+		"--files", filepath.Join(dir, "*.go"),
+		"--other", filepath.Join(dir, "*.md"),
+	}
+	if _, err := SubRegisterAndParse(opts, args); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "b.txt"),
+		filepath.Join(dir, "c.go"),
+	}
+	if !reflect.DeepEqual(opts.Files, want) {
+		t.Errorf("got %q, want %q", opts.Files, want)
+	}
+	if len(opts.Other) != 0 {
+		t.Errorf("got other %q, want none", opts.Other)
+	}
+
+	_, err := SubRegisterAndParse(opts, []string{"c", "--files", filepath.Join(dir, "*.md")})
+	if s := check.Error(err, "no files match"); s != "" {
+		t.Error(s)
+	}
+	_, err = SubRegisterAndParse(opts, []string{"c", "--files", "["})
+	if s := check.Error(err, "syntax error in pattern"); s != "" {
+		t.Error(s)
+	}
+}
+
+type routeSpec struct {
+	Src    string `flag:"--src the source"`
+	Dst    string `flag:"--dst the destination"`
+	Weight int
+}
+
+type Labels map[string]string
+
+func TestStringMap(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Labels map[string]string `flag:"--label=KEY=VALUE a label"`
+		Named  Labels            `flag:"--named=KEY=VALUE a named label"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want map[string]string
+		err  string
+	}{
+		{args: []string{"c"}},
+		{args: []string{"c", "--label", "env=prod", "--label", "team=search"}, want: map[string]string{"env": "prod", "team": "search"}},
+		{args: []string{"c", "--label", "env=prod", "--label", "env=dev"}, want: map[string]string{"env": "dev"}},
+		{args: []string{"c", "--label", "expr=a=b,empty="}, want: map[string]string{"expr": "a=b", "empty": ""}},
+		{args: []string{"c", "--label", `list=a\,b`}, want: map[string]string{"list": "a,b"}},
+		{args: []string{"c", "--label", "env"}, err: `invalid value "env" for flag -label: "env" is not of the form key=value`},
+	} {
+		opts := &options{}
+		_, err := SubRegisterAndParse(opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if !reflect.DeepEqual(opts.Labels, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.args, opts.Labels, tt.want)
+		}
+		if got := Lookup(opts, "label"); !reflect.DeepEqual(got, opts.Labels) {
+			t.Errorf("%q: Lookup got %v", tt.args, got)
+		}
+	}
+
+	// String can be passed back to Set.
+	m := stringMap{"b": "2,3", "a": "1"}
+	s := m.String()
+	if want := `a=1,b=2\,3`; s != want {
+		t.Errorf("got %s, want %s", s, want)
+	}
+	var got stringMap
+	if err := got.Set(s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("got %q, want %q", got, m)
+	}
+
+	opts := &options{}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--named", "a=1"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Labels{"a": "1"}); !reflect.DeepEqual(opts.Named, want) {
+		t.Errorf("got %q, want %q", opts.Named, want)
+	}
+
+	var help bytes.Buffer
+	Help(&help, "c", "", &options{Labels: map[string]string{"team": "search", "env": "prod"}})
+	if got := help.String(); !strings.Contains(got, "a label [env=prod,team=search]") {
+		t.Errorf("unexpected help:\n%s", got)
+	}
+}
+
+type backendSpec struct {
+	Type    string `flag:"--type=TYPE the backend type"`
+	Region  string `flag:"--region=REGION the region"`
+	Retries int    `flag:"--retries=N the retries"`
+}
+
+func TestStruct(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Backend backendSpec `flag:"--backend=SPEC {struct} the backend"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want backendSpec
+		err  string
+	}{
+		{args: []string{"c"}, want: backendSpec{Retries: 1}},
+		{args: []string{"c", "--backend", "type=s3,region=us-east-1"}, want: backendSpec{Type: "s3", Region: "us-east-1", Retries: 1}},
+		{args: []string{"c", "--backend", "type=s3", "--backend", "retries=5"}, want: backendSpec{Type: "s3", Retries: 5}},
+		{args: []string{"c", "--backend", "type=s3,zone=a"}, err: `invalid value "type=s3,zone=a" for flag -backend: unknown key "zone"`},
+		{args: []string{"c", "--backend", "retries=many"}, err: "retries: parse error"},
+		{args: []string{"c", "--backend", "s3"}, err: `"s3" is not of the form key=value`},
+	} {
+		opts := &options{Backend: backendSpec{Retries: 1}}
+		_, err := SubRegisterAndParse(opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if err != nil {
+			tt.want = backendSpec{Retries: 1}
+		}
+		if opts.Backend != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.args, opts.Backend, tt.want)
+		}
+	}
+
+	var help bytes.Buffer
+	Help(&help, "c", "", &options{Backend: backendSpec{Type: "s3", Retries: 2}})
+	if got := help.String(); !strings.Contains(got, "the backend [type=s3,retries=2]") {
+		t.Errorf("unexpected help:\n%s", got)
+	}
+
+	_, err := SubRegisterAndParse(&struct {
+		Backend string `flag:"--backend {struct}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{struct} requires a structure, not string"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestKVStruct(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Routes []routeSpec `flag:"--route=SPEC {kv-struct} a route"`
+	}
+	var opts options
+	args := []string{"c", "--route", "src=a,dst=b", "--route", "src=c,dst=d,weight=3"}
+	if _, err := SubRegisterAndParse(&opts, args); err != nil {
+		t.Fatal(err)
+	}
+	want := []routeSpec{{Src: "a", Dst: "b"}, {Src: "c", Dst: "d", Weight: 3}}
+	if !reflect.DeepEqual(opts.Routes, want) {
+		t.Errorf("got %+v, want %+v", opts.Routes, want)
+	}
+
+	for _, tt := range []struct {
+		arg string
+		err string
+	}{
+		{arg: "src=a,via=b", err: `unknown key "via"`},
+		{arg: "src", err: `"src" is not of the form key=value`},
+		{arg: "weight=heavy", err: "weight: parse error"},
+	} {
+		var opts options
+		_, err := SubRegisterAndParse(&opts, []string{"c", "--route", tt.arg})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s: %s", tt.arg, s)
+		}
+	}
+
+	var help bytes.Buffer
+	Help(&help, "c", "", &opts)
+	if got, want := help.String(), "[src=a,dst=b src=c,dst=d,weight=3]"; !strings.Contains(got, want) {
+		t.Errorf("help does not contain default %q:\n%s", want, got)
+	}
+
+	_, err := SubRegisterAndParse(&struct {
+		Routes []string `flag:"--route {kv-struct} a route"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{kv-struct} requires a slice of structures, not []string"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	opts := &struct {
+		Level   atomic.Int64  `flag:"--level=N the log level"`
+		Count   atomic.Uint32 `flag:"--count=N the count"`
+		Verbose atomic.Bool   `flag:"-v be verbose"`
+	}{}
+	opts.Count.Store(7)
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--level", "-3", "-v"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := opts.Level.Load(); got != -3 {
+		t.Errorf("got level %d, want -3", got)
+	}
+	if got := opts.Count.Load(); got != 7 {
+		t.Errorf("got count %d, want 7", got)
+	}
+	if !opts.Verbose.Load() {
+		t.Errorf("verbose not set")
+	}
+	want := `
+  --count=N    the count [7]
+  --level=N    the log level [-3]
+   -v          be verbose [true]
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "", "", opts)
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestKeepLast(t *testing.T) {
+	opts := &struct {
+		Tags []string `flag:"--tag=TAG {keep-last=3} a tag"`
+	}{}
+	args := []string{"c", "--tag", "a", "--tag", "b", "--tag", "c", "--tag", "d", "--tag", "e"}
+	if _, err := SubRegisterAndParse(opts, args); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"c", "d", "e"}
+	if !reflect.DeepEqual(opts.Tags, want) {
+		t.Errorf("got %q, want %q", opts.Tags, want)
+	}
+	_, err := SubRegisterAndParse(&struct {
+		Tags []string `flag:"--tag {keep-last=none}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, `{keep-last} requires a positive count: "none"`); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestRing(t *testing.T) {
+	for _, tt := range []struct {
+		tags []string
+		want []string
+	}{
+		{tags: []string{"a"}, want: []string{"a"}},
+		{tags: []string{"a", "b", "c"}, want: []string{"c", "b"}},
+		{tags: []string{"a", "b", "c", "d"}, want: []string{"c", "d"}},
+		{tags: []string{"a", "b", "c", "d", "e"}, want: []string{"e", "d"}},
+	} {
+		opts := &struct {
+			Tags []string `flag:"--tag=TAG {ring=2} a tag"`
+		}{}
+		args := []string{"c"}
+		for _, tag := range tt.tags {
+			args = append(args, "--tag", tag)
+		}
+		if _, err := SubRegisterAndParse(opts, args); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(opts.Tags, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.tags, opts.Tags, tt.want)
+		}
+	}
+	_, err := SubRegisterAndParse(&struct {
+		Tags []string `flag:"--tag {ring=0}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, `{ring} requires a positive size: "0"`); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestBitmask(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Features uint `flag:"--features=LIST {flags=a:1,b:2,c:4} the features"`
+	}
+	for _, tt := range []struct {
+		args []string
+		want uint
+		err  string
+	}{
+		{args: []string{"c"}},
+		{args: []string{"c", "--features", "a,c"}, want: 5},
+		{args: []string{"c", "--features", "b, a"}, want: 3},
+		{args: []string{"c", "--features", "a,a"}, want: 1},
+		{args: []string{"c", "--features", "a", "--features", "b"}, want: 2},
+		{args: []string{"c", "--features", ""}},
+		{args: []string{"c", "--features", "a,d"}, err: `unknown name "d", must be one of a, b, c`},
+	} {
+		opts := &options{}
+		_, err := SubRegisterAndParse(opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if opts.Features != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.args, opts.Features, tt.want)
+		}
+	}
+
+	want := `
+Usage: c [--features=LIST]
+  --features=LIST    the features [a,c,0x8]
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "c", "", &options{Features: 13})
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, tt := range []struct {
+		opts any
+		err  string
+	}{{
+		opts: &struct {
+			Features int `flag:"--features {flags=a:1}"`
+		}{},
+		err: "{flags} requires a uint, not int",
+	}, {
+		opts: &struct {
+			Features uint `flag:"--features {flags=a}"`
+		}{},
+		err: `{flags} requires NAME:BIT pairs: "a"`,
+	}, {
+		opts: &struct {
+			Features uint `flag:"--features {flags=a:x}"`
+		}{},
+		err: `{flags} invalid bit for a: "x"`,
+	}, {
+		opts: &struct {
+			Features uint `flag:"--features {flags=a:1,a:2}"`
+		}{},
+		err: "{flags} declares a more than once",
+	}} {
+		_, err := SubRegisterAndParse(tt.opts, []string{"c"})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Error(s)
+		}
+	}
+}
+
+func TestPreset(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Debug    bool   `flag:"--debug {preset=log-level:debug} enable debugging"`
+		LogLevel string `flag:"--log-level=LEVEL the log level"`
+	}
+	for _, tt := range []struct {
+		args  []string
+		debug bool
+		level string
+	}{
+		{[]string{"c"}, false, "info"},
+		{[]string{"c", "--debug"}, true, "debug"},
+		{[]string{"c", "--debug=false"}, false, "info"},
+		{[]string{"c", "--debug", "--log-level=warn"}, true, "warn"},
+	} {
+		opts := &options{LogLevel: "info"}
+		if _, err := SubRegisterAndParse(opts, tt.args); err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if opts.Debug != tt.debug || opts.LogLevel != tt.level {
+			t.Errorf("%q: got %v, %q, want %v, %q", tt.args, opts.Debug, opts.LogLevel, tt.debug, tt.level)
+		}
+	}
+
+	_, err := SubRegisterAndParse(&struct {
+		Debug bool `flag:"--debug {preset=missing:x}"`
+	}{}, []string{"c", "--debug"})
+	if s := check.Error(err, "preset flag missing is not defined"); s != "" {
+		t.Error(s)
+	}
+	_, err = SubRegisterAndParse(&struct {
+		Debug string `flag:"--debug {preset=level:x}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{preset} requires a bool flag: debug"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestNegatable(t *testing.T) {
+	type options struct {
+		Verbose bool `flag:"--verbose {negatable} be verbose"`
+	}
+	for _, tt := range []struct {
+		args    []string
+		verbose bool
+		init    bool
+	}{
+		{[]string{"c"}, false, false},
+		{[]string{"c"}, true, true},
+		{[]string{"c", "--verbose"}, true, false},
+		{[]string{"c", "--no-verbose"}, false, true},
+		{[]string{"c", "--verbose", "--no-verbose"}, false, false},
+		{[]string{"c", "--no-verbose", "--verbose"}, true, false},
+		{[]string{"c", "--no-verbose=false"}, true, false},
+	} {
+		opts := &options{Verbose: tt.init}
+		if _, err := SubRegisterAndParse(opts, tt.args); err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if opts.Verbose != tt.verbose {
+			t.Errorf("%q: got %v, want %v", tt.args, opts.Verbose, tt.verbose)
+		}
+	}
+
+	want := `
+Usage: c [--verbose]
+  --verbose    be verbose
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "c", "", &options{})
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	_, err := SubRegisterAndParse(&struct {
+		Level string `flag:"--level {negatable}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{negatable} requires a bool flag: level"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestCount(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Verbose int    `flag:"-v {count} be verbose"`
+		Quiet   bool   `flag:"-q be quiet"`
+		Name    string `flag:"-n=NAME the name"`
+	}
+	for _, tt := range []struct {
+		args    []string
+		verbose int
+		rest    []string
+		err     string
+	}{
+		{args: []string{"c"}},
+		{args: []string{"c", "-v"}, verbose: 1},
+		{args: []string{"c", "-v", "-v"}, verbose: 2},
+		{args: []string{"c", "-vvv"}, verbose: 3},
+		{args: []string{"c", "-vv", "-q", "-v"}, verbose: 3},
+		{args: []string{"c", "-v=5", "-vv"}, verbose: 7},
+		{args: []string{"c", "-n", "-vv", "-v"}, verbose: 1},
+		{args: []string{"c", "-v", "x", "-vv"}, verbose: 1, rest: []string{"x", "-vv"}},
+		{args: []string{"c", "-v", "--", "-vv"}, verbose: 1, rest: []string{"-vv"}},
+		{args: []string{"c", "--vv"}, err: "flag provided but not defined: -vv"},
+		{args: []string{"c", "-vq"}, err: "flag provided but not defined: -vq"},
+	} {
+		opts := &options{}
+		rest, err := SubRegisterAndParse(opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if opts.Verbose != tt.verbose {
+			t.Errorf("%q: got %d, want %d", tt.args, opts.Verbose, tt.verbose)
+		}
+		if len(rest) != 0 || len(tt.rest) != 0 {
+			if !reflect.DeepEqual(rest, tt.rest) {
+				t.Errorf("%q: got rest %q, want %q", tt.args, rest, tt.rest)
+			}
+		}
+	}
+
+	// A count does not take a value.
+	want := `
+Usage: c [-n=NAME] [-q] [-v]
+   -n=NAME    the name
+   -q         be quiet
+   -v         be verbose
+`[1:]
+	var out bytes.Buffer
+	Help(&out, "c", "", &options{})
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCountMax(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"c"}, 0},
+		{[]string{"c", "-v", "-v"}, 2},
+		{[]string{"c", "-v", "-v", "-v", "-v", "-v"}, 3},
+		{[]string{"c", "-v=2", "-v"}, 3},
+		{[]string{"c", "-v=10"}, 3},
+	} {
+		opts := &struct {
+			Verbose int `flag:"-v {count=3} increase verbosity"`
+		}{}
+		if _, err := SubRegisterAndParse(opts, tt.args); err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if opts.Verbose != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.args, opts.Verbose, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		opts any
+		err  string
+	}{{
+		opts: &struct {
+			Verbose int `flag:"-v {count=0} increase verbosity"`
+		}{},
+		err: `{count=N} requires a positive N: "0"`,
+	}, {
+		opts: &struct {
+			Verbose int `flag:"-v {count min=2} increase verbosity"`
+		}{},
+		err: "{count} may not have {min} or {max}",
+	}, {
+		opts: &struct {
+			Verbose int `flag:"-v {count max=3} increase verbosity"`
+		}{},
+		err: "{count} may not have {min} or {max}",
+	}} {
+		_, err := SubRegisterAndParse(tt.opts, []string{"c", "-v"})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Error(s)
+		}
+	}
+}
+
+type Env string
+
+const (
+	EnvDev  = Env("dev")
+	EnvProd = Env("prod")
+)
+
+type Level int
+
+type Names []string
+
+func TestNamedTypes(t *testing.T) {
+	opts := &struct {
+		Env   Env   `flag:"--env=ENV the environment"`
+		Level Level `flag:"--level=N the level"`
+		Names Names `flag:"--name=NAME a name"`
+	}{
+		Env: EnvDev,
+	}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--env", "prod", "--level", "3", "--name", "a", "--name", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Env != EnvProd {
+		t.Errorf("got env %q, want %q", opts.Env, EnvProd)
+	}
+	if opts.Level != 3 {
+		t.Errorf("got level %d, want 3", opts.Level)
+	}
+	if !reflect.DeepEqual(opts.Names, Names{"a", "b"}) {
+		t.Errorf("got names %q, want %q", opts.Names, Names{"a", "b"})
+	}
+	if env := Lookup(opts, "env").(Env); env != EnvProd {
+		t.Errorf("Lookup got %q, want %q", env, EnvProd)
+	}
+}
+
+func TestOptionalValue(t *testing.T) {
+	for _, tt := range []struct {
+		args  []string
+		color string
+		rest  []string
+	}{
+		{[]string{"c"}, "never", nil},
+		{[]string{"c", "--color"}, "auto", nil},
+		{[]string{"c", "--color=always"}, "always", nil},
+		{[]string{"c", "--color", "never"}, "auto", []string{"never"}},
+	} {
+		opts := &struct {
+			Color string `flag:"--color=WHEN {optional-value=auto} colorize output"`
+		}{
+			Color: "never",
+		}
+		rest, err := SubRegisterAndParse(opts, tt.args)
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if len(rest) == 0 {
+			rest = nil
+		}
+		if opts.Color != tt.color {
+			t.Errorf("%q: got %q, want %q", tt.args, opts.Color, tt.color)
+		}
+		if !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("%q: got args %q, want %q", tt.args, rest, tt.rest)
+		}
+	}
+	got := UsageLine("c", "", &struct {
+		Color string `flag:"--color=WHEN {optional-value=auto} colorize output"`
+	}{})
+	if want := "c [--color[=WHEN]]"; got != want {
+		t.Errorf("got usage %q, want %q", got, want)
+	}
+}
+
+func TestClock(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	for _, tt := range []struct {
+		in   string
+		want time.Duration
+		err  string
+	}{
+		{in: "01:30:15", want: time.Hour + 30*time.Minute + 15*time.Second},
+		{in: "05:00", want: 5 * time.Minute},
+		{in: "90", want: 90 * time.Second},
+		{in: "1h2m", want: time.Hour + 2*time.Minute},
+		{in: "1:2:3:4", err: `invalid clock duration "1:2:3:4"`},
+		{in: "1:60", err: `invalid clock duration "1:60"`},
+		{in: "1:x", err: `invalid clock duration "1:x"`},
+		{in: "forever", err: "parse error"},
+	} {
+		opts := &struct {
+			Offset time.Duration `flag:"--offset=TIME {clock} the offset"`
+		}{}
+		_, err := SubRegisterAndParse(opts, []string{"c", "--offset", tt.in})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s: %s", tt.in, s)
+			continue
+		}
+		if opts.Offset != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.in, opts.Offset, tt.want)
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	for _, tt := range []struct {
+		in   string
+		want time.Duration
+		err  string
+	}{
+		{in: "1h,30m,15s", want: time.Hour + 30*time.Minute + 15*time.Second},
+		{in: "90s", want: 90 * time.Second},
+		{in: "1m, -10s", want: 50 * time.Second},
+		{in: "1h,soon,15s", err: `invalid duration "soon"`},
+		{in: "1h,", err: `invalid duration ""`},
+	} {
+		opts := &struct {
+			Budget time.Duration `flag:"--budget=TIME {sum} the time budget"`
+		}{}
+		_, err := SubRegisterAndParse(opts, []string{"c", "--budget", tt.in})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s: %s", tt.in, s)
+			continue
+		}
+		if opts.Budget != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.in, opts.Budget, tt.want)
+		}
+	}
+}
+
+func TestSortedDedup(t *testing.T) {
+	args := []string{"c", "--tag", "c", "--tag", "a", "--tag", "b", "--tag", "a"}
+	sorted := &struct {
+		Tags []string `flag:"--tag=TAG {sorted} a tag"`
+	}{}
+	if _, err := SubRegisterAndParse(sorted, args); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "a", "b", "c"}; !reflect.DeepEqual(sorted.Tags, want) {
+		t.Errorf("sorted: got %q, want %q", sorted.Tags, want)
+	}
+
+	dedup := &struct {
+		Tags []string `flag:"--tag=TAG {dedup} a tag"`
+	}{}
+	if _, err := SubRegisterAndParse(dedup, args); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(dedup.Tags, want) {
+		t.Errorf("dedup: got %q, want %q", dedup.Tags, want)
+	}
+
+	both := &struct {
+		Tags []string `flag:"--tag=TAG {sorted dedup} a tag"`
+	}{}
+	if _, err := SubRegisterAndParse(both, args); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(both.Tags, want) {
+		t.Errorf("sorted dedup: got %q, want %q", both.Tags, want)
+	}
+
+	_, err := SubRegisterAndParse(&struct {
+		N int `flag:"--n {sorted}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{sorted} and {dedup} require an []string, not int"); s != "" {
+		t.Error(s)
+	}
+	for _, opts := range []any{
+		&struct {
+			Tags []string `flag:"--tag=TAG {sorted keep-last=2} a tag"`
+		}{},
+		&struct {
+			Tags []string `flag:"--tag=TAG {dedup ring=2} a tag"`
+		}{},
+	} {
+		_, err := SubRegisterAndParse(opts, args)
+		if s := check.Error(err, "{sorted} and {dedup} may not be used with {keep-last} or {ring}"); s != "" {
+			t.Error(s)
+		}
+	}
+}
+
+func TestRawOf(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Duration    time.Duration `flag:"--duration=TIME the duration"`
+		DurationRaw string        `flag:"{raw-of=duration}"`
+		Verbose     bool          `flag:"-v be verbose"`
+		VerboseRaw  string        `flag:" {raw-of=v} "`
+	}
+	var opts options
+	if _, err := SubRegisterAndParse(&opts, []string{"c", "--duration", "1.5h", "-v"}); err != nil {
+		t.Fatal(err)
+	}
+	want := options{Duration: 90 * time.Minute, DurationRaw: "1.5h", Verbose: true, VerboseRaw: "true"}
+	if opts != want {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+	if got := UsageLine("c", "", &opts); got != "c [--duration=TIME] [-v]" {
+		t.Errorf("got usage line %q", got)
+	}
+
+	opts = options{}
+	_, err := SubRegisterAndParse(&opts, []string{"c", "--duration", "soon"})
+	if s := check.Error(err, "parse error"); s != "" {
+		t.Error(s)
+	}
+	if opts.DurationRaw != "" {
+		t.Errorf("raw set to %q on error", opts.DurationRaw)
+	}
+
+	for _, tt := range []struct {
+		name string
+		opts any
+		err  string
+	}{{
+		name: "unknown",
+		opts: &struct {
+			Raw string `flag:"{raw-of=missing}"`
+		}{},
+		err: "{raw-of=missing} names an unknown flag",
+	}, {
+		name: "type",
+		opts: &struct {
+			N   int `flag:"--n the number"`
+			Raw int `flag:"{raw-of=n}"`
+		}{},
+		err: "{raw-of} requires a string, not int",
+	}} {
+		_, err := SubRegisterAndParse(tt.opts, []string{"c"})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s: %s", tt.name, s)
+		}
+	}
+}
+
+// A logLevel is decoded using a map of level names to levels passed as the
+// context.
+type logLevel int
+
+func (l *logLevel) Decode(ctx any, s string) error {
+	levels, ok := ctx.(map[string]logLevel)
+	if !ok {
+		return errors.New("no levels provided")
+	}
+	level, ok := levels[s]
+	if !ok {
+		return fmt.Errorf("unknown level %q", s)
+	}
+	*l = level
+	return nil
+}
+
+func TestDecoder(t *testing.T) {
+	levels := map[string]logLevel{"debug": 1, "info": 2}
+	type options struct {
+		Level logLevel `flag:"--level=LEVEL the log level"`
+	}
+	var opts options
+	set := NewFlagSet("")
+	set.SetOutput(&bytes.Buffer{})
+	if err := RegisterSetContext(levels, "", &opts, set); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Parse([]string{"--level", "info"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Level != 2 {
+		t.Errorf("got level %d, want 2", opts.Level)
+	}
+	err := set.Parse([]string{"--level", "trace"})
+	if s := check.Error(err, `unknown level "trace"`); s != "" {
+		t.Error(s)
+	}
+
+	// Without a context the Decoder is passed nil.
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	_, err = SubRegisterAndParse(&opts, []string{"c", "--level", "info"})
+	if s := check.Error(err, "no levels provided"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestSizedInts(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		I8  int8   `flag:"--i8=N an int8"`
+		I16 int16  `flag:"--i16=N an int16"`
+		I32 int32  `flag:"--i32=N an int32"`
+		U8  uint8  `flag:"--u8=N a uint8"`
+		U16 uint16 `flag:"--u16=N a uint16"`
+		U32 uint32 `flag:"--u32=N a uint32"`
+	}
+	Validate(&options{})
+	var opts options
+	args := []string{"c",
+		"--i8=-128", "--i16=32767", "--i32=-2147483648",
+		"--u8=0xff", "--u16=65535", "--u32=4294967295",
+	}
+	if _, err := SubRegisterAndParse(&opts, args); err != nil {
+		t.Fatal(err)
+	}
+	want := options{I8: -128, I16: 32767, I32: -2147483648, U8: 255, U16: 65535, U32: 4294967295}
+	if opts != want {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+	if got, ok := Lookup(&opts, "i16").(int16); !ok || got != 32767 {
+		t.Errorf("Lookup got %v (%T), want int16 32767", Lookup(&opts, "i16"), Lookup(&opts, "i16"))
+	}
+	if got, ok := Lookup(&opts, "u8").(uint8); !ok || got != 255 {
+		t.Errorf("Lookup got %v (%T), want uint8 255", Lookup(&opts, "u8"), Lookup(&opts, "u8"))
+	}
+	var help bytes.Buffer
+	Help(&help, "", "", &options{I16: 7})
+	if got := help.String(); !strings.Contains(got, "--i16=N    an int16 [7]") {
+		t.Errorf("unexpected help:\n%s", got)
+	}
+
+	for _, tt := range []struct {
+		arg string
+		err string
+	}{
+		{arg: "--i8=128", err: "value out of range"},
+		{arg: "--i16=-32769", err: "value out of range"},
+		{arg: "--i32=2147483648", err: "value out of range"},
+		{arg: "--u8=256", err: "value out of range"},
+		{arg: "--u16=-1", err: "parse error"},
+		{arg: "--u32=4294967296", err: "value out of range"},
+		{arg: "--i8=x", err: "parse error"},
+	} {
+		_, err := SubRegisterAndParse(&options{}, []string{"c", tt.arg})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s: %s", tt.arg, s)
+		}
+	}
+}
+
+func TestFloat32(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Ratio float32 `flag:"--ratio=R the ratio"`
+	}
+	opts := &options{Ratio: 0.5}
+	if _, err := SubRegisterAndParse(opts, []string{"c", "--ratio", "1.25"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Ratio != 1.25 {
+		t.Errorf("got %v, want 1.25", opts.Ratio)
+	}
+	if got, ok := Lookup(opts, "ratio").(float32); !ok || got != 1.25 {
+		t.Errorf("Lookup got %v (%T), want float32 1.25", Lookup(opts, "ratio"), Lookup(opts, "ratio"))
+	}
+	if d := Dup(opts).(*options); d.Ratio != 1.25 {
+		t.Errorf("Dup got %v, want 1.25", d.Ratio)
+	}
+	if got, want := UsageLine("c", "", &struct {
+		Ratio float32
+	}{}), "c [--ratio=VALUE]"; got != want {
+		t.Errorf("got usage %q, want %q", got, want)
+	}
+	var help bytes.Buffer
+	Help(&help, "", "", &options{Ratio: 0.1})
+	if got := help.String(); !strings.Contains(got, "the ratio [0.1]") {
+		t.Errorf("unexpected help:\n%s", got)
+	}
+
+	for _, tt := range []struct {
+		arg string
+		err string
+	}{
+		{arg: "1e39", err: "value out of range"},
+		{arg: "-1e39", err: "value out of range"},
+		{arg: "half", err: "parse error"},
+	} {
+		_, err := SubRegisterAndParse(&options{}, []string{"c", "--ratio", tt.arg})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%s: %s", tt.arg, s)
+		}
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	const large = "123456789012345678901234567890123456789"
+	for _, tt := range []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: large, want: large},
+		{in: "-" + large, want: "-" + large},
+		{in: "0xffffffffffffffffffffffff", want: "79228162514264337593543950335"},
+		{in: "12abc", err: `invalid value "12abc" for flag -modulus: parse error`},
+		{in: "", err: "parse error"},
+	} {
+		opts := &struct {
+			Modulus *big.Int `flag:"--modulus=N the modulus"`
+		}{}
+		_, err := SubRegisterAndParse(opts, []string{"c", "--modulus", tt.in})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.in, s)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := opts.Modulus.String(); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	var help bytes.Buffer
+	Help(&help, "", "", &struct {
+		Modulus *big.Int `flag:"--modulus=N the modulus"`
+	}{Modulus: big.NewInt(0xff)})
+	if got := help.String(); !strings.Contains(got, "the modulus [255]") {
+		t.Errorf("unexpected help:\n%s", got)
+	}
+}
+
+func TestURL(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Endpoint *url.URL `flag:"--endpoint=URL the server"`
+	}
+	for _, tt := range []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "https://example.com:8443/api?v=1", want: "https://example.com:8443/api?v=1"},
+		{in: "example.com", err: `URL "example.com" must have a scheme and a host`},
+		{in: "file:///tmp/x", err: "must have a scheme and a host"},
+		{in: "http://[::1", err: "missing ']' in host"},
+	} {
+		opts := &options{}
+		_, err := SubRegisterAndParse(opts, []string{"c", "--endpoint", tt.in})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.in, s)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := opts.Endpoint.String(); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.in, got, tt.want)
+		}
+		if got, ok := Lookup(opts, "endpoint").(*url.URL); !ok || got != opts.Endpoint {
+			t.Errorf("%q: Lookup got %v", tt.in, Lookup(opts, "endpoint"))
+		}
+	}
+
+	// No default.
+	opts := &options{}
+	if _, err := SubRegisterAndParse(opts, []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Endpoint != nil {
+		t.Errorf("got endpoint %v, want nil", opts.Endpoint)
+	}
+
+	u, _ := url.Parse("http://localhost:8080")
+	var help bytes.Buffer
+	Help(&help, "c", "", &options{Endpoint: u})
+	if got := help.String(); !strings.Contains(got, "the server [http://localhost:8080]") {
+		t.Errorf("unexpected help:\n%s", got)
+	}
+}
+
+func TestPort(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	for _, tt := range []struct {
+		in   string
+		any  bool
+		want Port
+		err  string
+	}{
+		{in: "8080", want: 8080},
+		{in: "65535", want: 65535},
+		{in: "0", err: `invalid value "0" for flag -port: invalid port "0", must be between 1 and 65535`},
+		{in: "0", any: true, want: 0},
+		{in: "65536", err: `invalid port "65536", must be between 1 and 65535`},
+		{in: "65536", any: true, err: `invalid port "65536", must be between 0 and 65535`},
+		{in: "-1", err: `invalid port "-1"`},
+		{in: "http", err: `invalid port "http"`},
+	} {
+		var opts any
+		var port *Port
+		if tt.any {
+			o := &struct {
+				Port Port `flag:"--port=PORT {any-port} the port"`
+			}{}
+			opts, port = o, &o.Port
+		} else {
+			o := &struct {
+				Port Port `flag:"--port=PORT the port"`
+			}{}
+			opts, port = o, &o.Port
+		}
+		_, err := SubRegisterAndParse(opts, []string{"c", "--port", tt.in})
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.in, s)
+			continue
+		}
+		if err == nil && *port != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.in, *port, tt.want)
+		}
+	}
+	_, err := SubRegisterAndParse(&struct {
+		Port int `flag:"--port {any-port}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{any-port} requires a flags.Port, not int"); s != "" {
+		t.Error(s)
+	}
+}
+
+func TestIP(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	type options struct {
+		Addr   net.IP    `flag:"--addr=IP bind address"`
+		Subnet net.IPNet `flag:"--subnet=CIDR the subnet"`
+	}
+	for _, tt := range []struct {
+		args   []string
+		addr   string
+		subnet string
+		err    string
+	}{
+		{args: []string{"c"}},
+		{args: []string{"c", "--addr", "192.168.1.10"}, addr: "192.168.1.10"},
+		{args: []string{"c", "--addr", "2001:0db8:0000::0001"}, addr: "2001:db8::1"},
+		{args: []string{"c", "--subnet", "10.1.2.3/8"}, subnet: "10.0.0.0/8"},
+		{args: []string{"c", "--subnet", "2001:db8::/32"}, subnet: "2001:db8::/32"},
+		{args: []string{"c", "--addr", "300.1.1.1"}, err: `invalid value "300.1.1.1" for flag -addr: invalid IP address "300.1.1.1"`},
+		{args: []string{"c", "--subnet", "10.0.0.0"}, err: `invalid CIDR address "10.0.0.0"`},
+	} {
+		opts := &options{}
+		_, err := SubRegisterAndParse(opts, tt.args)
+		if s := check.Error(err, tt.err); s != "" {
+			t.Errorf("%q: %s", tt.args, s)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := (*ipValue)(&opts.Addr).String(); got != tt.addr {
+			t.Errorf("%q: got addr %q, want %q", tt.args, got, tt.addr)
+		}
+		if got := (*ipNetValue)(&opts.Subnet).String(); got != tt.subnet {
+			t.Errorf("%q: got subnet %q, want %q", tt.args, got, tt.subnet)
+		}
+	}
+
+	want := `
+Usage: c [--addr=IP] [--subnet=CIDR]
+  --addr=IP        bind address [127.0.0.1]
+  --subnet=CIDR    the subnet [10.0.0.0/8]
+`[1:]
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/8")
+	var out bytes.Buffer
+	Help(&out, "c", "", &options{Addr: net.IPv4(127, 0, 0, 1), Subnet: *subnet})
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+type record struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestJSONL(t *testing.T) {
+	output = &bytes.Buffer{}
+	defer func() { output = nil }()
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.jsonl")
+	bad := filepath.Join(dir, "bad.jsonl")
+	if err := os.WriteFile(good, []byte(`{"id": 1, "name": "one"}`+"\n\n"+`{"id": 2, "name": "two"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bad, []byte(`{"id": 1}`+"\n"+`{"id": "two"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	type options struct {
+		Records []record `flag:"--records=FILE {jsonl} the input records"`
+	}
+	var opts options
+	if _, err := SubRegisterAndParse(&opts, []string{"c", "--records", "@" + good}); err != nil {
+		t.Fatal(err)
+	}
+	want := []record{{ID: 1, Name: "one"}, {ID: 2, Name: "two"}}
+	if !reflect.DeepEqual(opts.Records, want) {
+		t.Errorf("got %+v, want %+v", opts.Records, want)
+	}
+
+	opts = options{}
+	_, err := SubRegisterAndParse(&opts, []string{"c", "--records", "@" + bad})
+	if s := check.Error(err, "bad.jsonl:2: json: cannot unmarshal string"); s != "" {
+		t.Error(s)
+	}
+	if opts.Records != nil {
+		t.Errorf("records set to %+v on error", opts.Records)
+	}
+	_, err = SubRegisterAndParse(&opts, []string{"c", "--records", filepath.Join(dir, "missing.jsonl")})
+	if s := check.Error(err, "no such file or directory"); s != "" {
+		t.Error(s)
+	}
+	_, err = SubRegisterAndParse(&struct {
+		Record record `flag:"--record {jsonl}"`
+	}{}, []string{"c"})
+	if s := check.Error(err, "{jsonl} requires a slice"); s != "" {
+		t.Error(s)
+	}
+}